@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -41,6 +42,38 @@ func NewWriter(w io.Writer) (*Writer, error) {
 	return &ws, nil
 }
 
+// Create returns a tape.Writer writing an ar archive to w.
+func Create(w io.Writer) (tape.Writer, error) {
+	return NewWriter(w)
+}
+
+// OpenAppend prepares the ar archive stored in f to receive new members. The
+// returned Writer starts writing at the end of f. If f is empty, the magic
+// string of the archive is written first.
+func OpenAppend(f *os.File) (*Writer, error) {
+	i, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if i.Size() == 0 {
+		return NewWriter(f)
+	}
+	magic := make([]byte, len(Magic))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, Magic) {
+		return nil, tape.ErrMagic
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	ws := Writer{
+		inner: f,
+	}
+	return &ws, nil
+}
+
 func (w *Writer) WriteHeader(h *tape.Header) error {
 	if w.err != nil {
 		return w.err
@@ -107,14 +140,19 @@ type Reader struct {
 	inner *bufio.Reader
 	curr  io.Reader
 	err   error
+	count *counter
 
 	read int
 	size int
+
+	header int64
+	data   int64
 }
 
 func NewReader(r io.Reader) (*Reader, error) {
 	var (
-		tmp    = bufio.NewReader(r)
+		c      = counter{Reader: r}
+		tmp    = bufio.NewReader(&c)
 		b, err = tmp.Peek(len(Magic))
 	)
 	if err != nil {
@@ -128,10 +166,22 @@ func NewReader(r io.Reader) (*Reader, error) {
 	}
 	rs := Reader{
 		inner: tmp,
+		count: &c,
 	}
 	return &rs, nil
 }
 
+// Open returns a tape.Reader for the ar archive read from r.
+func Open(r io.Reader) (tape.Reader, error) {
+	return NewReader(r)
+}
+
+// Offset returns the positions of the header and of the data of the current
+// entry in the underlying stream.
+func (r *Reader) Offset() (int64, int64) {
+	return r.header, r.data
+}
+
 func (r *Reader) Read(bs []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
@@ -160,13 +210,18 @@ func (r *Reader) Next() (*tape.Header, error) {
 
 func (r *Reader) next() (*tape.Header, error) {
 	if r.curr != nil {
-		io.Copy(io.Discard, r.curr)
+		n, _ := io.Copy(io.Discard, r.curr)
+		r.read += int(n)
+		r.discard()
+		r.curr = nil
 	}
+	r.header = r.position()
 	h, err := r.readHeader()
 	if err != nil {
 		r.err = err
 		return nil, err
 	}
+	r.data = r.position()
 	r.curr = io.LimitReader(r.inner, h.Size)
 	r.read = 0
 	r.size = int(h.Size)
@@ -203,6 +258,21 @@ func (r *Reader) discard() {
 	r.inner.ReadByte()
 }
 
+func (r *Reader) position() int64 {
+	return r.count.N - int64(r.inner.Buffered())
+}
+
+type counter struct {
+	io.Reader
+	N int64
+}
+
+func (c *counter) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	c.N += int64(n)
+	return n, err
+}
+
 func readFilename(r io.Reader, h *tape.Header) error {
 	bs, err := readHeaderField(r, 16)
 	if err != nil {
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/ar"
+	"github.com/midbel/tape/cpio"
+	"github.com/midbel/tape/tar"
+)
+
+func runAppend(cmd *cli.Command, args []string) error {
+	preserve := cmd.Flag.Bool("p", false, "preserve")
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(cmd.Flag.Arg(0), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w tape.Writer
+	switch e := filepath.Ext(f.Name()); e {
+	case ".cpio":
+		w, err = cpio.OpenAppend(f)
+	case ".ar":
+		w, err = ar.OpenAppend(f)
+	case ".tar":
+		var t *tar.Writer
+		if t, err = tar.OpenAppend(f); err == nil {
+			w = &tar.TapeWriter{Writer: t}
+		}
+	default:
+		return ErrNotSupported(e)
+	}
+	if err != nil {
+		return err
+	}
+	args = cmd.Flag.Args()
+	return createArchive(w, args[1:], createOptions(*preserve))
+}
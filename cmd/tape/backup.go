@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/tar"
+)
+
+func runBackup(cmd *cli.Command, args []string) error {
+	var (
+		snapshot = cmd.Flag.String("snapshot", "", "snapshot file")
+		full     = cmd.Flag.Bool("full", false, "level 0 backup")
+		keep     = cmd.Flag.Bool("keep", false, "do not update the snapshot")
+		factor   = cmd.Flag.Int("b", 0, "blocking factor")
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	if *snapshot == "" {
+		return fmt.Errorf("snapshot file required")
+	}
+	file := cmd.Flag.Arg(0)
+	if f := formatName(file); f != "tar" {
+		return ErrNotSupported(f)
+	}
+	prev, err := readSnapshot(*snapshot)
+	if err != nil {
+		return err
+	}
+	if *full {
+		prev = nil
+	}
+
+	f, err := createFile(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w tape.Writer
+	if *factor > 0 {
+		w = tar.NewTapeWriterSize(f, *factor)
+	} else {
+		w = tar.NewTapeWriter(f)
+	}
+	b := backup{
+		writer: w,
+		prev:   prev,
+		next: &tar.Snapshot{
+			Time: time.Now(),
+		},
+	}
+	args = cmd.Flag.Args()
+	for _, a := range args[1:] {
+		if err := b.backupPath(a); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if *keep && prev != nil {
+		return nil
+	}
+	return writeSnapshot(*snapshot, b.next)
+}
+
+// backup writes to an archive the files changed since the backup recorded by
+// prev. The state of the directories found is recorded in next.
+type backup struct {
+	writer tape.Writer
+	prev   *tar.Snapshot
+	next   *tar.Snapshot
+}
+
+func (b *backup) backupPath(file string) error {
+	file = filepath.Clean(file)
+	dir, base := filepath.Split(file)
+	if dir == "" {
+		dir = "."
+	}
+	fi, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return b.backupFile(dir, base, fi)
+	}
+	return b.backupDir(dir, base, fi)
+}
+
+// backupDir writes the directory name found in root with its dumpdir then the
+// files of the directory that have changed. Every file is written when the
+// directory was not recorded in the previous snapshot or has been replaced
+// since.
+func (b *backup) backupDir(root, name string, fi os.FileInfo) error {
+	es, err := os.ReadDir(filepath.Join(root, name))
+	if err != nil {
+		return err
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].Name() < es[j].Name()
+	})
+	var (
+		h     = tape.FileInfoHeaderFromInfo(fi)
+		dev   = uint64(h.Major)<<32 | uint64(h.Minor)
+		prev  = b.prev.Dir(name)
+		fresh = prev == nil || prev.Dev != dev || prev.Inode != uint64(h.Inode)
+		dump  []tar.DumpEntry
+		infos = make(map[string]os.FileInfo)
+	)
+	for _, e := range es {
+		i, err := e.Info()
+		if err != nil {
+			return err
+		}
+		d := tar.DumpEntry{
+			Name: e.Name(),
+			Type: tar.DumpUnchanged,
+		}
+		switch {
+		case i.IsDir():
+			d.Type = tar.DumpDirectory
+		case fresh || !prev.Has(d.Name) || changedSince(i, b.prev.Time):
+			d.Type = tar.DumpIncluded
+		}
+		dump = append(dump, d)
+		infos[d.Name] = i
+	}
+	h.Filename = name
+	h.Records = map[string]string{
+		tar.DumpdirRecord: string(tar.FormatDumpdir(dump)),
+	}
+	if err := b.writer.WriteHeader(h); err != nil {
+		return err
+	}
+	b.next.Dirs = append(b.next.Dirs, &tar.SnapshotDir{
+		ModTime:  fi.ModTime(),
+		Dev:      dev,
+		Inode:    uint64(h.Inode),
+		Name:     name,
+		Contents: dump,
+	})
+	for _, d := range dump {
+		if d.Type != tar.DumpIncluded {
+			continue
+		}
+		if err := b.backupFile(root, path.Join(name, d.Name), infos[d.Name]); err != nil {
+			return err
+		}
+	}
+	for _, d := range dump {
+		if d.Type != tar.DumpDirectory {
+			continue
+		}
+		if err := b.backupDir(root, path.Join(name, d.Name), infos[d.Name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedSince reports whether the file described by fi has been modified
+// since t. The time of the last change of its status is also checked since
+// the modification time is not updated when the permissions or the owner of
+// a file change, and can be set back to an older time by tools like cp -p.
+func changedSince(fi os.FileInfo, t time.Time) bool {
+	return !fi.ModTime().Before(t) || !tape.ChangeTime(fi).Before(t)
+}
+
+func (b *backup) backupFile(root, name string, fi os.FileInfo) error {
+	var (
+		file = filepath.Join(root, name)
+		h    = tape.FileInfoHeaderFromInfo(fi)
+	)
+	h.Filename = name
+	if h.IsSymlink() {
+		link, err := os.Readlink(file)
+		if err != nil {
+			return err
+		}
+		h.Linkname = link
+	}
+	if err := b.writer.WriteHeader(h); err != nil {
+		return err
+	}
+	if !h.IsRegular() || h.Size == 0 {
+		return nil
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.CopyN(b.writer, r, h.Size)
+	return err
+}
+
+func readSnapshot(file string) (*tar.Snapshot, error) {
+	r, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer r.Close()
+	return tar.ReadSnapshot(r)
+}
+
+// writeSnapshot replaces the snapshot file once the new snapshot has been
+// completely written.
+func writeSnapshot(file string, s *tar.Snapshot) error {
+	w, err := os.CreateTemp(filepath.Dir(file), ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(w.Name())
+	if _, err := s.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.Name(), file)
+}
+
+func runRestore(cmd *cli.Command, args []string) error {
+	var (
+		datadir = cmd.Flag.String("d", ".", "datadir")
+		input   = addReadFlags(&cmd.Flag)
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*datadir, 0755); err != nil {
+		return err
+	}
+	e := extractor{
+		datadir: *datadir,
+	}
+	for _, a := range cmd.Flag.Args() {
+		if err := restoreArchive(a, &e, input); err != nil {
+			return err
+		}
+	}
+	if e.refused == 0 {
+		return nil
+	}
+	return cli.Exit(fmt.Errorf("%d member(s) not restored", e.refused), 2)
+}
+
+// restoreArchive extracts the content of an archive of a backup into the
+// directory of e. The files of a directory that are not listed in its
+// dumpdir have been removed since the previous backup and are deleted. As
+// with extract, the members leading outside of the directory are refused.
+func restoreArchive(file string, e *extractor, input *readFlags) error {
+	r, c, err := input.openArchive(file)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	type dir struct {
+		target string
+		perm   os.FileMode
+		mtime  time.Time
+	}
+	var dirs []dir
+	for {
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		var link string
+		target, err := e.resolve(h.Filename, true)
+		if err == nil && h.IsRegular() && h.Linkname != "" {
+			link, err = e.resolve(h.Linkname, false)
+		}
+		if errors.Is(err, errUnsafe) {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s, not restored\n", file, h.Filename, err)
+			e.refused++
+			if _, err := io.CopyN(io.Discard, r, h.Size); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case h.IsDir():
+			err = restoreDir(target, h)
+			dirs = append(dirs, dir{
+				target: target,
+				perm:   os.FileMode(h.Perm()) & os.ModePerm,
+				mtime:  h.ModTime,
+			})
+		case h.IsSymlink():
+			if err = os.RemoveAll(target); err == nil {
+				err = os.Symlink(h.Linkname, target)
+			}
+		case link != "":
+			if err = os.RemoveAll(target); err == nil {
+				err = os.Link(link, target)
+			}
+		case h.IsRegular():
+			err = restoreFile(target, r, h)
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %s: file type not restored\n", file, h.Filename)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.target, d.perm); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.target, d.mtime, d.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreDir creates the directory target and deletes the files it holds
+// that are not listed in the dumpdir of h. An existing file or symbolic link
+// named target is replaced. The directory is left writable until its members
+// are restored.
+func restoreDir(target string, h *tape.Header) error {
+	if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(target, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if err := os.Chmod(target, 0700); err != nil {
+		return err
+	}
+	dump, ok := h.Records[tar.DumpdirRecord]
+	if !ok {
+		return nil
+	}
+	es, err := tar.ParseDumpdir([]byte(dump))
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]struct{})
+	for _, e := range es {
+		keep[e.Name] = struct{}{}
+	}
+	files, err := os.ReadDir(target)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, ok := keep[f.Name()]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(target, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreFile writes the content of h to target. An existing file of
+// another type named target is replaced and never followed.
+func restoreFile(target string, r io.Reader, h *tape.Header) error {
+	if fi, err := os.Lstat(target); err == nil && !fi.Mode().IsRegular() {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	w, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Perm()))
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, r, h.Size); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, os.FileMode(h.Perm())); err != nil {
+		return err
+	}
+	return os.Chtimes(target, h.ModTime, h.ModTime)
+}
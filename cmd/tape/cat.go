@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/midbel/cli"
+)
+
+func runCat(cmd *cli.Command, args []string) error {
+	var (
+		flags = addSelectFlags(&cmd.Flag)
+		input = addReadFlags(&cmd.Flag)
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	args = cmd.Flag.Args()
+	if len(args) == 0 {
+		return fmt.Errorf("archive required")
+	}
+	sel, err := flags.selection(args[1:])
+	if err != nil {
+		return err
+	}
+	r, c, err := input.openArchive(args[0])
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	for {
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if !h.IsRegular() || !sel.Match(h.Filename) {
+			continue
+		}
+		if _, err := io.CopyN(out, r, h.Size); err != nil {
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return reportMissing(sel)
+}
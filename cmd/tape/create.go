@@ -2,100 +2,253 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"syscall"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/midbel/cli"
 	"github.com/midbel/tape"
 	"github.com/midbel/tape/ar"
 	"github.com/midbel/tape/cpio"
+	"github.com/midbel/tape/iso"
+	"github.com/midbel/tape/tar"
 )
 
 func runCreate(cmd *cli.Command, args []string) error {
-	preserve := cmd.Flag.Bool("p", false, "preserve")
+	var (
+		preserve     = cmd.Flag.Bool("p", false, "preserve")
+		label        = cmd.Flag.String("V", "", "volume label")
+		reproducible = cmd.Flag.Bool("reproducible", false, "reproducible")
+		digest       = cmd.Flag.String("digest", "", "digest algorithm")
+		spec         = cmd.Flag.String("from-mtree", "", "mtree specification")
+		volume       = cmd.Flag.String("L", "", "volume size")
+		factor       = cmd.Flag.Int("b", 0, "blocking factor")
+		format       = cmd.Flag.String("F", "", "archive format")
+		list         = cmd.Flag.String("T", "", "file list")
+		null         = cmd.Flag.Bool("null", false, "NUL separated file list")
+		names        = addNameFlags(&cmd.Flag)
+		crypt        = addEncryptFlags(&cmd.Flag, true)
+	)
 	if err := cmd.Flag.Parse(args); err != nil {
 		return err
 	}
-	var files []string
-	if cmd.Flag.NArg() == 1 {
-		s := bufio.NewScanner(os.Stdin)
-		for s.Scan() {
-			files = append(files, s.Text())
+	mapper, err := names.mapper()
+	if err != nil {
+		return err
+	}
+	var listed []string
+	if *list != "" {
+		fs, err := readFileList(*list, *null)
+		if err != nil {
+			return err
 		}
-		if err := s.Err(); err != nil {
+		listed = fs
+	}
+	var (
+		file = cmd.Flag.Arg(0)
+		kind = *format
+	)
+	if kind == "" && crypt.enabled() {
+		kind = formatName(strings.TrimSuffix(file, ".enc"))
+	} else if kind == "" {
+		kind = formatName(file)
+	}
+	switch kind {
+	case "cpio", "ar", "tar", "iso":
+	default:
+		return ErrNotSupported(kind)
+	}
+	var epoch time.Time
+	if *reproducible {
+		e, err := tape.SourceDateEpoch()
+		if err != nil {
 			return err
 		}
-	} else {
-		args := cmd.Flag.Args()
-		files = args[1:]
+		epoch = e
 	}
-	f, err := os.Create(cmd.Flag.Arg(0))
-	if err != nil {
-		return err
+	if *digest != "" {
+		if _, err := tape.NewHash(*digest); err != nil {
+			return err
+		}
+	}
+	var f io.WriteCloser
+	if *volume != "" {
+		if kind != "tar" || file == "-" {
+			return fmt.Errorf("multi-volume archives are only supported for tar files")
+		}
+		if crypt.enabled() {
+			return fmt.Errorf("multi-volume archives can not be encrypted")
+		}
+		size, err := parseSize(*volume)
+		if err != nil {
+			return err
+		}
+		if f, err = tar.CreateVolumes(file, size); err != nil {
+			return err
+		}
+	} else {
+		c, err := createFile(file)
+		if err != nil {
+			return err
+		}
+		if f, err = crypt.writer(c); err != nil {
+			c.Close()
+			return err
+		}
 	}
 	defer f.Close()
 
 	var w tape.Writer
-	switch e := filepath.Ext(f.Name()); e {
-	case ".cpio":
+	switch kind {
+	case "cpio":
 		w = cpio.NewWriter(f)
-	case ".ar":
+	case "ar":
 		a, err := ar.NewWriter(f)
 		if err != nil {
 			return err
 		}
 		w = a
-	default:
-		return ErrNotSupported(e)
+	case "tar":
+		if *factor > 0 {
+			w = tar.NewTapeWriterSize(f, *factor)
+		} else {
+			w = tar.NewTapeWriter(f)
+		}
+	case "iso":
+		if *label == "" && file != "-" {
+			*label = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		w = iso.NewWriter(f, *label)
+	}
+	opts := createOptions(*preserve || *reproducible)
+	opts.Digest = *digest
+	if *reproducible {
+		w = tape.NewReproducibleWriter(w, epoch)
+	}
+	if mapper != nil {
+		w = tape.MapWriter(w, mapper)
 	}
-	return createArchive(w, files, *preserve)
+	if *spec != "" {
+		err = createFromSpec(w, *spec, opts)
+	} else {
+		err = createListed(w, listed, cmd.Flag.Args()[1:], opts)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func createListed(w tape.Writer, listed, files []string, opts tape.FSOptions) error {
+	for _, f := range listed {
+		if err := appendListed(w, f, opts); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return createArchive(w, files, opts)
+}
+
+func createOptions(preserve bool) tape.FSOptions {
+	var opts tape.FSOptions
+	if !preserve {
+		opts.Owner = true
+		opts.Uid, opts.Gid = int64(os.Geteuid()), int64(os.Getgid())
+		opts.ModTime = time.Now()
+	}
+	return opts
 }
 
-func createArchive(w tape.Writer, files []string, preserve bool) error {
-	defer w.Close()
+func createArchive(w tape.Writer, files []string, opts tape.FSOptions) error {
 	for _, f := range files {
-		if err := appendFile(w, f, preserve); err != nil {
+		if err := appendFile(w, f, opts); err != nil {
+			w.Close()
 			return err
 		}
 	}
-	return nil
+	return w.Close()
 }
 
-func appendFile(w tape.Writer, file string, preserve bool) error {
-	r, err := os.Open(file)
-	if err != nil {
-		return err
+func appendFile(w tape.Writer, file string, opts tape.FSOptions) error {
+	dir, base := filepath.Split(filepath.Clean(file))
+	if dir == "" {
+		dir = "."
 	}
-	defer r.Close()
+	opts.Paths = []string{base}
+	return tape.WriteFS(w, os.DirFS(dir), opts)
+}
 
-	i, err := r.Stat()
+// parseSize parses a size given in bytes or with one of the K, M or G
+// suffixes.
+func parseSize(str string) (int64, error) {
+	var (
+		unit int64 = 1
+		num        = strings.TrimRight(str, "KMGkmg")
+	)
+	switch strings.ToUpper(str[len(num):]) {
+	case "":
+	case "K":
+		unit = 1 << 10
+	case "M":
+		unit = 1 << 20
+	case "G":
+		unit = 1 << 30
+	default:
+		return 0, fmt.Errorf("%s: invalid size", str)
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s: invalid size", str)
+	}
+	return n * unit, nil
+}
+
+// appendListed writes file and, when it is a directory, its content to w.
+// Unlike the files given on the command line, listed files keep their path
+// without the leading slash.
+func appendListed(w tape.Writer, file string, opts tape.FSOptions) error {
+	dir, file := ".", filepath.Clean(file)
+	if filepath.IsAbs(file) {
+		dir, file = "/", strings.TrimLeft(file, "/")
+	}
+	opts.Paths = []string{filepath.ToSlash(file)}
+	return tape.WriteFS(w, os.DirFS(dir), opts)
+}
+
+// readFileList reads the names of the files listed in file, one per line or,
+// when null is set, separated by NUL bytes. The list is read from stdin when
+// file is "-".
+func readFileList(file string, null bool) ([]string, error) {
+	r, err := openFile(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	h := tape.Header{
-		Filename: i.Name(),
-		ModTime:  i.ModTime(),
-		Mode:     int64(i.Mode()),
-		Size:     i.Size(),
+	defer r.Close()
+
+	s := bufio.NewScanner(r)
+	if null {
+		s.Split(scanNull)
 	}
-	if i, ok := i.Sys().(*syscall.Stat_t); ok {
-		h.Uid = int64(i.Uid)
-		h.Gid = int64(i.Gid)
-		h.Major = int64(i.Dev >> 32)
-		h.Minor = int64(i.Dev & 0xFFFFFFFF)
-		h.Links = int64(i.Nlink)
-		h.Inode = int64(i.Ino)
+	var files []string
+	for s.Scan() {
+		if f := s.Text(); f != "" {
+			files = append(files, f)
+		}
 	}
-	if !preserve {
-		h.Uid, h.Gid = int64(os.Geteuid()), int64(os.Getgid())
-		h.ModTime = time.Now()
+	return files, s.Err()
+}
+
+func scanNull(data []byte, atEOF bool) (int, []byte, error) {
+	if x := bytes.IndexByte(data, 0); x >= 0 {
+		return x + 1, data[:x], nil
 	}
-	if err = w.WriteHeader(&h); err != nil {
-		return err
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
 	}
-	_, err = io.Copy(w, r)
-	return err
+	return 0, nil, nil
 }
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+)
+
+const (
+	maxTextSize  = 64 << 10
+	diffContext  = 3
+	maxDiffCells = 1 << 22
+)
+
+type member struct {
+	*tape.Header
+	sum  [sha256.Size]byte
+	text []byte
+}
+
+func runDiff(cmd *cli.Command, args []string) error {
+	var (
+		unified = cmd.Flag.Bool("u", false, "unified diff of text members")
+		input   = addReadFlags(&cmd.Flag)
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	if cmd.Flag.NArg() != 2 {
+		return fmt.Errorf("diff: two archives expected")
+	}
+	left, err := readMembers(cmd.Flag.Arg(0), *unified, input)
+	if err != nil {
+		return err
+	}
+	right, err := readMembers(cmd.Flag.Arg(1), *unified, input)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]struct{})
+	for n := range left {
+		names[n] = struct{}{}
+	}
+	for n := range right {
+		names[n] = struct{}{}
+	}
+	var all []string
+	for n := range names {
+		all = append(all, n)
+	}
+	sort.Strings(all)
+
+	var count int
+	for _, n := range all {
+		a, b := left[n], right[n]
+		switch {
+		case a == nil:
+			fmt.Fprintf(os.Stdout, "+ %s\n", n)
+			count++
+		case b == nil:
+			fmt.Fprintf(os.Stdout, "- %s\n", n)
+			count++
+		default:
+			ds := compareMembers(a, b)
+			if len(ds) == 0 {
+				break
+			}
+			count++
+			fmt.Fprintf(os.Stdout, "~ %s\n", n)
+			for _, d := range ds {
+				fmt.Fprintf(os.Stdout, "    %s\n", d)
+			}
+			if *unified && a.text != nil && b.text != nil && a.sum != b.sum {
+				unifiedDiff(os.Stdout, cmd.Flag.Arg(0)+":"+n, cmd.Flag.Arg(1)+":"+n, a.text, b.text)
+			}
+		}
+	}
+	if count > 0 {
+		return cli.Exit(fmt.Errorf("%d entries differ", count), 1)
+	}
+	return nil
+}
+
+func readMembers(file string, keepText bool, input *readFlags) (map[string]*member, error) {
+	r, c, err := input.openArchive(file)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ms := make(map[string]*member)
+	for {
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		m := member{Header: h}
+		if h.IsRegular() && h.Linkname == "" {
+			var (
+				sum = sha256.New()
+				buf bytes.Buffer
+				w   io.Writer = sum
+			)
+			if keepText && h.Size <= maxTextSize {
+				w = io.MultiWriter(sum, &buf)
+			}
+			if _, err := io.CopyN(w, r, h.Size); err != nil {
+				return nil, err
+			}
+			copy(m.sum[:], sum.Sum(nil))
+			if b := buf.Bytes(); keepText && h.Size <= maxTextSize && isText(b) {
+				m.text = b
+			}
+		}
+		ms[tape.CleanName(h.Filename)] = &m
+	}
+	return ms, nil
+}
+
+func compareMembers(a, b *member) []string {
+	var ds []string
+	delta := func(field string, x, y interface{}) {
+		ds = append(ds, fmt.Sprintf("%s: %v -> %v", field, x, y))
+	}
+	if a.Mode&tape.ModeType != b.Mode&tape.ModeType && !(a.IsRegular() && b.IsRegular()) {
+		delta("type", fileType(a.Header), fileType(b.Header))
+		return ds
+	}
+	if a.Perm() != b.Perm() {
+		delta("mode", fmt.Sprintf("%04o", a.Perm()), fmt.Sprintf("%04o", b.Perm()))
+	}
+	if a.Uid != b.Uid || a.Gid != b.Gid {
+		delta("owner", fmt.Sprintf("%d:%d", a.Uid, a.Gid), fmt.Sprintf("%d:%d", b.Uid, b.Gid))
+	}
+	if a.ModTime.Unix() != b.ModTime.Unix() {
+		delta("mtime", a.ModTime.UTC().Format(time.RFC3339), b.ModTime.UTC().Format(time.RFC3339))
+	}
+	if a.Linkname != b.Linkname {
+		delta("link", a.Linkname, b.Linkname)
+	}
+	if a.IsDevice() && (a.RMajor != b.RMajor || a.RMinor != b.RMinor) {
+		delta("device", fmt.Sprintf("%d,%d", a.RMajor, a.RMinor), fmt.Sprintf("%d,%d", b.RMajor, b.RMinor))
+	}
+	if a.IsRegular() && a.Linkname == "" {
+		if a.Size != b.Size {
+			delta("size", a.Size, b.Size)
+		}
+		if a.sum != b.sum {
+			delta("sha256", fmt.Sprintf("%x", a.sum), fmt.Sprintf("%x", b.sum))
+		}
+	}
+	return ds
+}
+
+func isText(b []byte) bool {
+	return utf8.Valid(b) && bytes.IndexByte(b, 0) < 0
+}
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff writes the differences between a and b in the unified format.
+// The edit script is computed from the longest common subsequence of the
+// lines which limits it to small files.
+func unifiedDiff(w io.Writer, from, to string, a, b []byte) {
+	var (
+		xs = splitLines(a)
+		ys = splitLines(b)
+	)
+	if len(xs)*len(ys) > maxDiffCells {
+		fmt.Fprintf(w, "    (files too large to be compared)\n")
+		return
+	}
+	lines := diffLines(xs, ys)
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to)
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].op != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+		writeHunk(w, lines, start, end)
+		i = end
+	}
+}
+
+func writeHunk(w io.Writer, lines []diffLine, start, end int) {
+	var (
+		left, right    int
+		lcount, rcount int
+	)
+	for _, d := range lines[:start] {
+		if d.op != '+' {
+			left++
+		}
+		if d.op != '-' {
+			right++
+		}
+	}
+	for _, d := range lines[start:end] {
+		if d.op != '+' {
+			lcount++
+		}
+		if d.op != '-' {
+			rcount++
+		}
+	}
+	if lcount > 0 {
+		left++
+	}
+	if rcount > 0 {
+		right++
+	}
+	fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", left, lcount, right, rcount)
+	for _, d := range lines[start:end] {
+		fmt.Fprintf(w, "%c%s\n", d.op, d.text)
+	}
+}
+
+func diffLines(xs, ys []string) []diffLine {
+	var (
+		n     = len(xs)
+		m     = len(ys)
+		table = make([]int, (n+1)*(m+1))
+		at    = func(i, j int) int { return i*(m+1) + j }
+	)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if xs[i] == ys[j] {
+				table[at(i, j)] = table[at(i+1, j+1)] + 1
+			} else if table[at(i+1, j)] >= table[at(i, j+1)] {
+				table[at(i, j)] = table[at(i+1, j)]
+			} else {
+				table[at(i, j)] = table[at(i, j+1)]
+			}
+		}
+	}
+	var (
+		lines []diffLine
+		i, j  int
+	)
+	for i < n && j < m {
+		switch {
+		case xs[i] == ys[j]:
+			lines = append(lines, diffLine{op: ' ', text: xs[i]})
+			i++
+			j++
+		case table[at(i+1, j)] >= table[at(i, j+1)]:
+			lines = append(lines, diffLine{op: '-', text: xs[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: ys[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, diffLine{op: '-', text: xs[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, diffLine{op: '+', text: ys[j]})
+	}
+	return lines
+}
+
+func splitLines(b []byte) []string {
+	str := strings.TrimSuffix(string(b), "\n")
+	if str == "" {
+		return nil
+	}
+	return strings.Split(str, "\n")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/tar"
+)
+
+func runDelete(cmd *cli.Command, args []string) error {
+	factor := cmd.Flag.Int("b", 0, "blocking factor")
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	args = cmd.Flag.Args()
+	if len(args) <= 1 {
+		return nil
+	}
+	return rewriteArchive(args[0], *factor, tape.Delete(args[1:]...))
+}
+
+func runReplace(cmd *cli.Command, args []string) error {
+	factor := cmd.Flag.Int("b", 0, "blocking factor")
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	args = cmd.Flag.Args()
+	if len(args) <= 1 {
+		return nil
+	}
+	var edits []tape.Edit
+	for _, file := range args[1:] {
+		e, err := tape.ReplaceFile(filepath.ToSlash(filepath.Clean(file)), file)
+		if err != nil {
+			return err
+		}
+		edits = append(edits, e)
+	}
+	return rewriteArchive(args[0], *factor, edits...)
+}
+
+func runRename(cmd *cli.Command, args []string) error {
+	factor := cmd.Flag.Int("b", 0, "blocking factor")
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	if cmd.Flag.NArg() != 3 {
+		return fmt.Errorf("archive, member and new name required")
+	}
+	return rewriteArchive(cmd.Flag.Arg(0), *factor, tape.Rename(cmd.Flag.Arg(1), cmd.Flag.Arg(2)))
+}
+
+func runChmod(cmd *cli.Command, args []string) error {
+	factor := cmd.Flag.Int("b", 0, "blocking factor")
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	args = cmd.Flag.Args()
+	if len(args) <= 2 {
+		return fmt.Errorf("archive, mode and members required")
+	}
+	mode, err := strconv.ParseInt(args[1], 8, 64)
+	if err != nil || mode&^07777 != 0 {
+		return fmt.Errorf("%s: invalid mode", args[1])
+	}
+	var edits []tape.Edit
+	for _, p := range args[2:] {
+		edits = append(edits, tape.Chmod(p, mode))
+	}
+	return rewriteArchive(args[0], *factor, edits...)
+}
+
+func runChown(cmd *cli.Command, args []string) error {
+	factor := cmd.Flag.Int("b", 0, "blocking factor")
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	args = cmd.Flag.Args()
+	if len(args) <= 2 {
+		return fmt.Errorf("archive, owner and members required")
+	}
+	uid, gid, err := parseOwner(args[1])
+	if err != nil {
+		return err
+	}
+	var edits []tape.Edit
+	for _, p := range args[2:] {
+		edits = append(edits, tape.Chown(p, uid, gid))
+	}
+	return rewriteArchive(args[0], *factor, edits...)
+}
+
+// parseOwner parses an owner given as user[:group]. The user and the group can
+// be names or numeric ids. The ids not given are returned as -1.
+func parseOwner(owner string) (int64, int64, error) {
+	var (
+		uname, gname, _ = strings.Cut(owner, ":")
+		uid, gid        = int64(-1), int64(-1)
+		err             error
+	)
+	if uname != "" {
+		if uid, err = tape.LookupUid(uname); err != nil {
+			return uid, gid, err
+		}
+	}
+	if gname != "" {
+		if gid, err = tape.LookupGid(gname); err != nil {
+			return uid, gid, err
+		}
+	}
+	if uid < 0 && gid < 0 {
+		return uid, gid, fmt.Errorf("%s: invalid owner", owner)
+	}
+	return uid, gid, nil
+}
+
+// rewriteArchive applies edits on the archive stored in file. With a blocking
+// factor, the archive is rewritten as a tar archive made of records of factor
+// blocks.
+func rewriteArchive(file string, factor int, edits ...tape.Edit) error {
+	if factor > 0 {
+		open := func(r io.Reader) (tape.Reader, error) {
+			return tar.NewTapeReaderSize(r, factor), nil
+		}
+		create := func(w io.Writer) (tape.Writer, error) {
+			return tar.NewTapeWriterSize(w, factor), nil
+		}
+		return tape.RewriteFile(file, open, create, edits...)
+	}
+	open, err := openFunc(file)
+	if err != nil {
+		return err
+	}
+	create, err := createFunc(file)
+	if err != nil {
+		return err
+	}
+	return tape.RewriteFile(file, open, create, edits...)
+}
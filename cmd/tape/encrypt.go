@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape/encrypt"
+)
+
+func runEncrypt(cmd *cli.Command, args []string) error {
+	var (
+		keyfile  = cmd.Flag.String("k", "", "key file")
+		passfile = cmd.Flag.String("passphrase", "", "passphrase file")
+		algo     = cmd.Flag.String("c", "aes", "cipher")
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	c, err := parseCipher(*algo)
+	if err != nil {
+		return err
+	}
+	secret, err := readSecret(*keyfile, *passfile)
+	if err != nil {
+		return err
+	}
+	return transformFile(cmd.Flag.Arg(0), cmd.Flag.Arg(1), func(r io.Reader, w io.Writer) error {
+		var (
+			ew  *encrypt.Writer
+			err error
+		)
+		if *keyfile != "" {
+			ew, err = encrypt.NewWriter(w, c, secret)
+		} else {
+			ew, err = encrypt.NewPassphraseWriter(w, c, secret)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(ew, r); err != nil {
+			return err
+		}
+		return ew.Close()
+	})
+}
+
+func runDecrypt(cmd *cli.Command, args []string) error {
+	var (
+		keyfile  = cmd.Flag.String("k", "", "key file")
+		passfile = cmd.Flag.String("passphrase", "", "passphrase file")
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	secret, err := readSecret(*keyfile, *passfile)
+	if err != nil {
+		return err
+	}
+	return transformFile(cmd.Flag.Arg(0), cmd.Flag.Arg(1), func(r io.Reader, w io.Writer) error {
+		var (
+			er  *encrypt.Reader
+			err error
+		)
+		if *keyfile != "" {
+			er, err = encrypt.NewReader(r, secret)
+		} else {
+			er, err = encrypt.NewPassphraseReader(r, secret)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, er)
+		return err
+	})
+}
+
+// encryptFlags are the options of the commands reading or writing encrypted
+// archives. Encryption is enabled by -encrypt or when a key file or a
+// passphrase is given.
+type encryptFlags struct {
+	encrypt  bool
+	keyfile  string
+	passfile string
+	cipher   string
+}
+
+func addEncryptFlags(set *flag.FlagSet, writing bool) *encryptFlags {
+	var f encryptFlags
+	set.BoolVar(&f.encrypt, "encrypt", false, "encrypted archive")
+	set.StringVar(&f.keyfile, "key", "", "key file")
+	set.StringVar(&f.passfile, "passphrase", "", "passphrase file")
+	if writing {
+		set.StringVar(&f.cipher, "cipher", "aes", "cipher")
+	}
+	return &f
+}
+
+func (f *encryptFlags) enabled() bool {
+	return f.encrypt || f.keyfile != "" || f.passfile != ""
+}
+
+// reader returns a reader decrypting the archive read from r or r itself when
+// encryption is not enabled.
+func (f *encryptFlags) reader(r io.Reader) (io.Reader, error) {
+	if !f.enabled() {
+		return r, nil
+	}
+	secret, err := readSecret(f.keyfile, f.passfile)
+	if err != nil {
+		return nil, err
+	}
+	if f.keyfile != "" {
+		return encrypt.NewReader(r, secret)
+	}
+	return encrypt.NewPassphraseReader(r, secret)
+}
+
+// writer returns a writer encrypting the archive written to w or w itself
+// when encryption is not enabled. Closing the returned writer writes the last
+// chunk of the encrypted stream and closes w.
+func (f *encryptFlags) writer(w io.WriteCloser) (io.WriteCloser, error) {
+	if !f.enabled() {
+		return w, nil
+	}
+	c, err := parseCipher(f.cipher)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := readSecret(f.keyfile, f.passfile)
+	if err != nil {
+		return nil, err
+	}
+	var ew *encrypt.Writer
+	if f.keyfile != "" {
+		ew, err = encrypt.NewWriter(w, c, secret)
+	} else {
+		ew, err = encrypt.NewPassphraseWriter(w, c, secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedFile{Writer: ew, file: w}, nil
+}
+
+type encryptedFile struct {
+	*encrypt.Writer
+	file io.Closer
+}
+
+func (e *encryptedFile) Close() error {
+	err := e.Writer.Close()
+	if e := e.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func parseCipher(name string) (encrypt.Cipher, error) {
+	switch name {
+	case "aes", "aes-256-gcm":
+		return encrypt.AES256GCM, nil
+	case "chacha", "chacha20-poly1305":
+		return encrypt.ChaCha20Poly1305, nil
+	default:
+		return 0, fmt.Errorf("%s: unsupported cipher", name)
+	}
+}
+
+func readSecret(keyfile, passfile string) ([]byte, error) {
+	switch {
+	case keyfile != "" && passfile != "":
+		return nil, fmt.Errorf("key file and passphrase can not be used together")
+	case keyfile != "":
+		return encrypt.ReadKeyFile(keyfile)
+	case passfile != "":
+		b, err := os.ReadFile(passfile)
+		if err != nil {
+			return nil, err
+		}
+		b = bytes.TrimRight(b, "\r\n")
+		if len(b) == 0 {
+			return nil, fmt.Errorf("%s: empty passphrase", passfile)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("key file or passphrase required")
+	}
+}
+
+// transformFile writes to the file named dst the result of fn applied on the
+// content of src. dst is removed if fn fails. "-" stands for stdin and stdout.
+func transformFile(src, dst string, fn func(io.Reader, io.Writer) error) error {
+	r, err := openFile(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := createFile(dst)
+	if err != nil {
+		return err
+	}
+	if err := fn(r, w); err != nil {
+		w.Close()
+		if dst != "-" {
+			os.Remove(dst)
+		}
+		return err
+	}
+	return w.Close()
+}
@@ -2,101 +2,520 @@ package main
 
 import (
 	"errors"
+	"flag"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/midbel/cli"
 	"github.com/midbel/tape"
-	"github.com/midbel/tape/ar"
-	"github.com/midbel/tape/cpio"
 )
 
 func runExtract(cmd *cli.Command, args []string) error {
 	var (
 		preserve = cmd.Flag.Bool("p", false, "preserve")
 		datadir  = cmd.Flag.String("d", os.TempDir(), "datadir")
+		flags    = addSelectFlags(&cmd.Flag)
+		names    = addNameFlags(&cmd.Flag)
+		owners   = addOwnerFlags(&cmd.Flag)
+		policies = addPolicyFlags(&cmd.Flag)
+		input    = addReadFlags(&cmd.Flag)
 	)
 	if err := cmd.Flag.Parse(args); err != nil {
 		return err
 	}
-	f, err := os.Open(cmd.Flag.Arg(0))
+	args = cmd.Flag.Args()
+	sel, err := flags.selection(args[1:])
+	if err != nil {
+		return err
+	}
+	mapper, err := names.mapper()
+	if err != nil {
+		return err
+	}
+	own, err := owners.ownership(*preserve)
+	if err != nil {
+		return err
+	}
+	policy, err := policies.policy()
+	if err != nil {
+		return err
+	}
+	f, err := openFile(cmd.Flag.Arg(0))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	var r tape.Reader
-	switch e := filepath.Ext(f.Name()); e {
-	case ".cpio":
-		r = cpio.NewReader(f)
-	case ".ar", ".deb":
-		if a, e := ar.NewReader(f); e != nil {
-			err = e
-		} else {
-			r = a
+	r, err := input.reader(f, cmd.Flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	r = sel.Reader(r)
+	if mapper != nil {
+		r = tape.MapReader(r, mapper)
+	}
+	e := extractor{
+		datadir:  *datadir,
+		preserve: *preserve,
+		owner:    own,
+		policy:   policy,
+	}
+	if err := e.extractArchive(r); err != nil {
+		return err
+	}
+	if err := reportMissing(sel); err != nil || e.refused == 0 {
+		return err
+	}
+	return cli.Exit(fmt.Errorf("%d member(s) not extracted", e.refused), 2)
+}
+
+// overwritePolicy tells what to do with the files already existing where the
+// entries of an archive are extracted.
+type overwritePolicy int
+
+const (
+	// replaceFiles writes the new content to a temporary file renamed over
+	// the existing file once complete.
+	replaceFiles overwritePolicy = iota
+	// keepOldFiles never replaces existing files.
+	keepOldFiles
+	// skipNewerFiles keeps the existing files more recent than the entries.
+	skipNewerFiles
+	// overwriteFiles writes over the content of the existing regular files.
+	overwriteFiles
+	// unlinkFirst removes the existing files before creating the new ones.
+	unlinkFirst
+)
+
+// policyFlags are the options selecting the overwritePolicy.
+type policyFlags struct {
+	keepOld   bool
+	skipNewer bool
+	overwrite bool
+	unlink    bool
+}
+
+func addPolicyFlags(set *flag.FlagSet) *policyFlags {
+	var f policyFlags
+	set.BoolVar(&f.keepOld, "keep-old-files", false, "do not replace existing files")
+	set.BoolVar(&f.skipNewer, "skip-newer", false, "do not replace existing files newer than members")
+	set.BoolVar(&f.overwrite, "overwrite", false, "overwrite existing files in place")
+	set.BoolVar(&f.unlink, "unlink-first", false, "remove existing files before extracting")
+	return &f
+}
+
+func (f *policyFlags) policy() (overwritePolicy, error) {
+	var (
+		policy = replaceFiles
+		count  int
+	)
+	for _, p := range []struct {
+		set    bool
+		policy overwritePolicy
+	}{
+		{f.keepOld, keepOldFiles},
+		{f.skipNewer, skipNewerFiles},
+		{f.overwrite, overwriteFiles},
+		{f.unlink, unlinkFirst},
+	} {
+		if p.set {
+			policy = p.policy
+			count++
 		}
+	}
+	if count > 1 {
+		return policy, fmt.Errorf("only one of -keep-old-files, -skip-newer, -overwrite and -unlink-first can be given")
+	}
+	return policy, nil
+}
+
+// keep reports whether the existing file described by fi should be kept
+// instead of being replaced by the entry h.
+func (p overwritePolicy) keep(fi fs.FileInfo, h *tape.Header) bool {
+	switch p {
+	case keepOldFiles:
+		return true
+	case skipNewerFiles:
+		return fi.ModTime().After(h.ModTime)
 	default:
-		return ErrNotSupported(e)
+		return false
+	}
+}
+
+// errUnsafe is the error of the members that would be extracted outside of
+// the extraction directory.
+var errUnsafe = errors.New("unsafe path")
+
+// extractor extracts the members of an archive into datadir. The members are
+// never written outside of datadir: the leading slashes of the names are
+// removed, the names with a ".." component are refused and so are the names
+// leading through a symbolic link found in datadir.
+//
+// Directories are created writable so that their members can be extracted
+// whatever their mode. Their mode and their modification time are set once
+// every member has been extracted.
+type extractor struct {
+	datadir  string
+	preserve bool
+	owner    *tape.Ownership
+	policy   overwritePolicy
+	refused  int
+	dirs     []extractedDir
+}
+
+type extractedDir struct {
+	file  string
+	perm  os.FileMode
+	mtime time.Time
+}
+
+func (e *extractor) extractArchive(r tape.Reader) error {
+	var err error
+	for err == nil {
+		err = e.extractFile(r)
+	}
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if derr := e.finishDirs(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// finishDirs sets the mode and, when preserved, the modification time of the
+// extracted directories, the deepest ones first.
+func (e *extractor) finishDirs() error {
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		d := e.dirs[i]
+		if err := os.Chmod(d.file, d.perm); err != nil {
+			return err
+		}
+		if !e.preserve {
+			continue
+		}
+		if err := os.Chtimes(d.file, d.mtime, d.mtime); err != nil {
+			return err
+		}
 	}
+	e.dirs = e.dirs[:0]
+	return nil
+}
+
+func (e *extractor) extractFile(r tape.Reader) error {
+	h, err := r.Next()
 	if err != nil {
 		return err
 	}
-	args = cmd.Flag.Args()
-	return extractArchive(r, *datadir, args[1:], *preserve)
-}
 
-func extractArchive(r tape.Reader, datadir string, members []string, preserve bool) error {
-	if len(members) == 0 {
+	file, err := e.resolve(h.Filename, true)
+	if err == nil && h.IsRegular() && h.Linkname != "" {
+		_, err = e.resolve(h.Linkname, false)
+	}
+	if errors.Is(err, errUnsafe) {
+		fmt.Fprintf(os.Stderr, "%s: %s, not extracted\n", h.Filename, err)
+		e.refused++
+		_, err := io.CopyN(io.Discard, r, h.Size)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	fi, err := os.Lstat(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if fi != nil && !(fi.IsDir() && h.IsDir()) && e.policy.keep(fi, h) {
+		fmt.Fprintf(os.Stderr, "%s: already exists, not replaced\n", file)
+		_, err := io.CopyN(io.Discard, r, h.Size)
+		return err
+	}
+	if h.IsDevice() || h.Mode&tape.ModeType == tape.ModeSocket {
+		fmt.Fprintf(os.Stderr, "%s: file type not extracted\n", h.Filename)
+		_, err := io.CopyN(io.Discard, r, h.Size)
+		return err
+	}
+	if fi != nil && fi.IsDir() && !h.IsDir() {
+		// only empty directories are replaced by other kinds of files.
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		fi = nil
+	}
+	switch {
+	case h.IsDir():
+		err = e.extractDir(file, fi, h)
+	case h.IsSymlink():
+		err = e.extractSymlink(file, fi, h)
+	case h.Mode&tape.ModeType == tape.ModeFifo:
+		err = e.extractFifo(file, fi, h)
+	case h.Linkname != "":
+		err = e.extractLink(file, fi, h)
+	default:
+		err = e.extractRegular(file, fi, r, h)
+	}
+	if err != nil {
+		return err
+	}
+	if e.owner != nil {
+		uid, gid := e.owner.Resolve(h)
+		if err := changeOwner(file, uid, gid); err != nil {
+			return err
+		}
+	}
+	if h.IsDir() || h.IsSymlink() {
 		return nil
 	}
-	sort.Strings(members)
-	for {
-		err := extractFile(r, datadir, members, preserve)
+	if !e.preserve {
+		h.ModTime = time.Now()
+	}
+	return os.Chtimes(file, h.ModTime, h.ModTime)
+}
+
+// resolve returns the path in datadir of the member name. The parent
+// directories of the member are created when create is set.
+func (e *extractor) resolve(name string, create bool) (string, error) {
+	name = strings.TrimLeft(name, "/")
+	for _, p := range strings.Split(name, "/") {
+		if p == ".." {
+			return "", fmt.Errorf("%w: name contains ..", errUnsafe)
+		}
+	}
+	var (
+		parts = strings.Split(path.Clean(name), "/")
+		dir   = e.datadir
+	)
+	for _, p := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, p)
+		fi, err := os.Lstat(dir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && create:
+			err = os.Mkdir(dir, 0755)
+		case err != nil:
+		case fi.Mode()&fs.ModeSymlink != 0:
+			err = fmt.Errorf("%w: %s is a symbolic link", errUnsafe, dir)
+		case !fi.IsDir():
+			err = fmt.Errorf("%s: not a directory", dir)
+		}
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
+			return "", err
+		}
+	}
+	return filepath.Join(e.datadir, filepath.FromSlash(path.Clean(name))), nil
+}
+
+func (e *extractor) extractDir(file string, fi fs.FileInfo, h *tape.Header) error {
+	if fi != nil && !fi.IsDir() {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		fi = nil
+	}
+	if fi == nil {
+		if err := os.Mkdir(file, 0700); err != nil {
 			return err
 		}
 	}
+	e.dirs = append(e.dirs, extractedDir{
+		file:  file,
+		perm:  os.FileMode(h.Perm()) & os.ModePerm,
+		mtime: h.ModTime,
+	})
 	return nil
 }
 
-func extractFile(r tape.Reader, datadir string, members []string, preserve bool) error {
-	h, err := r.Next()
+func (e *extractor) extractSymlink(file string, fi fs.FileInfo, h *tape.Header) error {
+	if fi == nil {
+		return os.Symlink(h.Linkname, file)
+	}
+	if e.policy == overwriteFiles || e.policy == unlinkFirst {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		return os.Symlink(h.Linkname, file)
+	}
+	tmp, err := tempName(file, func(name string) error {
+		return os.Symlink(h.Linkname, name)
+	})
 	if err != nil {
 		return err
 	}
-	ix := sort.SearchStrings(members, h.Filename)
-	if ix >= len(members) || members[ix] != h.Filename {
-		_, err = io.CopyN(io.Discard, r, h.Size)
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
 		return err
 	}
+	return nil
+}
 
-	file := filepath.Join(datadir, h.Filename)
-	w, err := os.Create(file)
+func (e *extractor) extractRegular(file string, fi fs.FileInfo, r io.Reader, h *tape.Header) error {
+	var (
+		perm   = os.FileMode(h.Perm()) & os.ModePerm
+		create = os.O_CREATE | os.O_EXCL | os.O_WRONLY
+		direct = e.policy == overwriteFiles || e.policy == unlinkFirst
+		tmp    string
+		w      *os.File
+		err    error
+	)
+	switch {
+	case !direct:
+		tmp, err = tempName(file, func(name string) error {
+			w, err = os.OpenFile(name, create, perm)
+			return err
+		})
+	case fi == nil:
+		w, err = os.OpenFile(file, create, perm)
+	case e.policy == overwriteFiles && fi.Mode().IsRegular():
+		w, err = os.OpenFile(file, os.O_WRONLY|os.O_TRUNC, perm)
+	default:
+		if err = os.Remove(file); err == nil {
+			w, err = os.OpenFile(file, create, perm)
+		}
+	}
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	_, err = io.CopyN(w, r, h.Size)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if tmp == "" {
+		return err
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
 
-	if _, err := io.Copy(w, r); err != nil {
+// extractLink creates file as a hard link to the member h.Linkname extracted
+// before it.
+func (e *extractor) extractLink(file string, fi fs.FileInfo, h *tape.Header) error {
+	target, err := e.resolve(h.Linkname, false)
+	if err != nil {
+		return err
+	}
+	if fi == nil {
+		return os.Link(target, file)
+	}
+	if e.policy == overwriteFiles || e.policy == unlinkFirst {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		return os.Link(target, file)
+	}
+	tmp, err := tempName(file, func(name string) error {
+		return os.Link(target, name)
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
 		return err
 	}
+	return nil
+}
 
-	if !preserve {
-		h.Uid, h.Gid = int64(os.Geteuid()), int64(os.Getgid())
-		h.ModTime = time.Now()
+func (e *extractor) extractFifo(file string, fi fs.FileInfo, h *tape.Header) error {
+	if fi != nil {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
 	}
-	return updateFileInfo(file, h.Uid, h.Gid, h.ModTime)
+	return mkfifo(file, uint32(h.Perm()))
 }
 
-func updateFileInfo(file string, uid, gid int64, mod time.Time) error {
-	if err := os.Chown(file, int(uid), int(gid)); err != nil {
-		return err
+// tempName calls create with a name in the directory of file not used yet.
+// It returns the name given to create when it succeeds.
+func tempName(file string, create func(string) error) (string, error) {
+	dir, base := filepath.Split(file)
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, fmt.Sprintf(".%s.%d.%d", base, os.Getpid(), i))
+		err := create(name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// changeOwner changes the owner of file. Failing to do so is only reported as
+// a warning when not running as root since the owner of a file can not be
+// given away in that case.
+func changeOwner(file string, uid, gid int64) error {
+	err := os.Lchown(file, int(uid), int(gid))
+	if err != nil && os.Geteuid() != 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		err = nil
+	}
+	return err
+}
+
+// ownerFlags are the options telling how the owner of the extracted files is
+// restored.
+type ownerFlags struct {
+	numeric bool
+	owner   string
+	group   string
+	uidMaps stringList
+	gidMaps stringList
+}
+
+func addOwnerFlags(set *flag.FlagSet) *ownerFlags {
+	var f ownerFlags
+	set.BoolVar(&f.numeric, "numeric-owner", false, "use numeric ids instead of names")
+	set.StringVar(&f.owner, "owner", "", "force owner of extracted files")
+	set.StringVar(&f.group, "group", "", "force group of extracted files")
+	set.Var(&f.uidMaps, "uid-map", "map uids with id:hostid:size")
+	set.Var(&f.gidMaps, "gid-map", "map gids with id:hostid:size")
+	return &f
+}
+
+// ownership returns the tape.Ownership made of the options or nil when the
+// owner of the files is not restored, that is when preserve is not set and
+// none of the options has been given.
+func (f *ownerFlags) ownership(preserve bool) (*tape.Ownership, error) {
+	set := f.numeric || f.owner != "" || f.group != "" || len(f.uidMaps) > 0 || len(f.gidMaps) > 0
+	if !preserve && !set {
+		return nil, nil
+	}
+	o := tape.Ownership{
+		Numeric: f.numeric,
+	}
+	if f.owner != "" {
+		if err := o.SetOwner(f.owner); err != nil {
+			return nil, err
+		}
+	}
+	if f.group != "" {
+		if err := o.SetGroup(f.group); err != nil {
+			return nil, err
+		}
+	}
+	for _, str := range f.uidMaps {
+		m, err := tape.ParseIDMap(str)
+		if err != nil {
+			return nil, err
+		}
+		o.UidMaps = append(o.UidMaps, m)
+	}
+	for _, str := range f.gidMaps {
+		m, err := tape.ParseIDMap(str)
+		if err != nil {
+			return nil, err
+		}
+		o.GidMaps = append(o.GidMaps, m)
 	}
-	return os.Chtimes(file, mod, mod)
+	return &o, nil
 }
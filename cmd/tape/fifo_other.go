@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/midbel/tape"
+)
+
+func mkfifo(file string, perm uint32) error {
+	return fmt.Errorf("%s: %w: fifo", file, tape.ErrUnsupported)
+}
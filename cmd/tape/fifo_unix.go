@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func mkfifo(file string, perm uint32) error {
+	if err := syscall.Mkfifo(file, perm); err != nil {
+		return &os.PathError{Op: "mkfifo", Path: file, Err: err}
+	}
+	return nil
+}
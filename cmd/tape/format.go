@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/ar"
+	"github.com/midbel/tape/cpio"
+	"github.com/midbel/tape/iso"
+	"github.com/midbel/tape/squashfs"
+	"github.com/midbel/tape/tar"
+)
+
+func openFunc(file string) (tape.OpenFunc, error) {
+	switch e := filepath.Ext(file); e {
+	case ".cpio":
+		return cpio.Open, nil
+	case ".ar", ".deb":
+		return ar.Open, nil
+	case ".tar":
+		return tar.Open, nil
+	case ".squashfs", ".sqfs":
+		return openSquashfs, nil
+	case ".iso":
+		return iso.Open, nil
+	default:
+		return nil, ErrNotSupported(e)
+	}
+}
+
+func openSquashfs(r io.Reader) (tape.Reader, error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, fmt.Errorf("squashfs: %w: not seekable", tape.ErrUnsupported)
+	}
+	return squashfs.NewReader(ra)
+}
+
+// readFlags are the options of the commands reading archives. With a
+// blocking factor, the archive must be a tar archive and is read as records
+// of factor blocks.
+type readFlags struct {
+	factor int
+	crypt  *encryptFlags
+}
+
+func addReadFlags(set *flag.FlagSet) *readFlags {
+	f := readFlags{
+		crypt: addEncryptFlags(set, false),
+	}
+	set.IntVar(&f.factor, "b", 0, "blocking factor")
+	return &f
+}
+
+// openArchive opens file and returns a tape.Reader for its content. The
+// returned io.Closer closes the file.
+func (f *readFlags) openArchive(file string) (tape.Reader, io.Closer, error) {
+	c, err := openFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := f.reader(c, file)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return r, c, nil
+}
+
+// reader returns a tape.Reader for the archive file read from r.
+func (f *readFlags) reader(r io.Reader, file string) (tape.Reader, error) {
+	r, err := f.crypt.reader(r)
+	if err != nil {
+		return nil, err
+	}
+	if f.factor <= 0 {
+		return openReader(r, file)
+	}
+	if _, err := openFunc(file); err == nil {
+		if n := formatName(file); n != "tar" {
+			return nil, fmt.Errorf("%w: blocking factor with %s archive", tape.ErrUnsupported, n)
+		}
+		return tar.NewTapeReaderSize(r, f.factor), nil
+	}
+	rs := bufio.NewReaderSize(r, magicSize)
+	if magic, _ := rs.Peek(magicSize); !isTar(magic) {
+		return nil, fmt.Errorf("%w: blocking factor with non tar archive", tape.ErrUnsupported)
+	}
+	return tar.NewTapeReaderSize(rs, f.factor), nil
+}
+
+// openReader returns a tape.Reader for the archive read from r. The format of
+// the archive is given by the extension of file or, when it is not known,
+// detected from the content of the archive.
+func openReader(r io.Reader, file string) (tape.Reader, error) {
+	open, err := openFunc(file)
+	if err != nil {
+		if open, r, err = detectFormat(r); err != nil {
+			return nil, err
+		}
+	}
+	return open(r)
+}
+
+const magicSize = 512
+
+// detectFormat recognizes the format of the archive read from r by its magic.
+// The returned io.Reader should be used in place of r since the magic might
+// have been consumed.
+func detectFormat(r io.Reader) (tape.OpenFunc, io.Reader, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		buf := make([]byte, magicSize)
+		n, err := ra.ReadAt(buf, 0)
+		if err == nil || errors.Is(err, io.EOF) {
+			if iso.IsImage(ra) {
+				return iso.Open, r, nil
+			}
+			open, err := formatOf(buf[:n])
+			return open, r, err
+		}
+	}
+	rs := bufio.NewReaderSize(r, magicSize)
+	buf, _ := rs.Peek(magicSize)
+	open, err := formatOf(buf)
+	return open, rs, err
+}
+
+func formatOf(magic []byte) (tape.OpenFunc, error) {
+	switch {
+	case bytes.HasPrefix(magic, ar.Magic):
+		return ar.Open, nil
+	case bytes.HasPrefix(magic, []byte("070701")), bytes.HasPrefix(magic, []byte("070702")):
+		return cpio.Open, nil
+	case bytes.HasPrefix(magic, []byte("hsqs")):
+		return openSquashfs, nil
+	case isTar(magic):
+		return tar.Open, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown archive format", tape.ErrUnsupported)
+	}
+}
+
+func isTar(magic []byte) bool {
+	return len(magic) >= 262 && string(magic[257:262]) == "ustar"
+}
+
+// openFile opens file or returns stdin when file is "-". If file does not
+// exist but its first volume does, the volumes of the archive are read as a
+// single file.
+func openFile(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(file)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return f, err
+	}
+	if _, e := os.Stat(tar.VolumeName(file, 0)); e != nil {
+		return nil, err
+	}
+	return tar.OpenVolumes(file), nil
+}
+
+// createFile creates file or returns stdout when file is "-".
+func createFile(file string) (io.WriteCloser, error) {
+	if file == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(file)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// formatName returns the name of the format of the archive file given by its
+// extension. Archives written to stdout are tar archives.
+func formatName(file string) string {
+	if file == "-" {
+		return "tar"
+	}
+	switch e := filepath.Ext(file); e {
+	case ".deb":
+		return "ar"
+	case ".sqfs":
+		return "squashfs"
+	default:
+		return strings.TrimPrefix(e, ".")
+	}
+}
+
+func createFunc(file string) (tape.CreateFunc, error) {
+	switch e := filepath.Ext(file); e {
+	case ".cpio":
+		return cpio.Create, nil
+	case ".ar", ".deb":
+		return ar.Create, nil
+	case ".tar":
+		return tar.Create, nil
+	default:
+		return nil, ErrNotSupported(e)
+	}
+}
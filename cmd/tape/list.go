@@ -1,52 +1,86 @@
 package main
 
 import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/midbel/cli"
 	"github.com/midbel/tape"
-	"github.com/midbel/tape/ar"
-	"github.com/midbel/tape/cpio"
 )
 
 const pattern = "%s\t%s\t%s\t%d\t%s\t%s\n"
 
 const (
 	dateYear  = "Jan 02  2006"
-	dateTime  = "Jan 02 15:05"
-	isoFormat = "2006-01-02T15:05:04"
+	dateTime  = "Jan 02 15:04"
+	isoFormat = "2006-01-02T15:04:05"
 )
 
 func runList(cmd *cli.Command, args []string) error {
 	var (
-		block = cmd.Flag.String("b", "", "block")
-		iso   = cmd.Flag.Bool("i", false, "iso format")
+		unit   = cmd.Flag.String("u", "", "size unit")
+		iso    = cmd.Flag.Bool("i", false, "iso format")
+		format = cmd.Flag.String("format", "", "output format")
+		tmpl   = cmd.Flag.String("template", "", "output template")
+		flags  = addSelectFlags(&cmd.Flag)
+		input  = addReadFlags(&cmd.Flag)
 	)
 	if err := cmd.Flag.Parse(args); err != nil {
 		return err
 	}
-
-	var open OpenFunc
-	switch ext := filepath.Ext(cmd.Flag.Arg(0)); ext {
-	case ".cpio":
-		open = func(r io.Reader) (tape.Reader, error) {
-			return cpio.NewReader(r), nil
-		}
-	case ".ar", ".deb":
-		open = func(r io.Reader) (tape.Reader, error) {
-			return ar.NewReader(r)
+	args = cmd.Flag.Args()
+	sel, err := flags.selection(args[1:])
+	if err != nil {
+		return err
+	}
+	var ew entryWriter
+	switch {
+	case *tmpl != "":
+		t, err := template.New("list").Parse(*tmpl)
+		if err != nil {
+			return err
 		}
+		ew = &templateWriter{tmpl: t, out: bufio.NewWriter(os.Stdout)}
+	case *format == "json":
+		ew = &jsonWriter{out: os.Stdout}
+	case *format == "ndjson":
+		out := bufio.NewWriter(os.Stdout)
+		ew = &ndjsonWriter{out: out, enc: json.NewEncoder(out)}
+	case *format == "csv":
+		ew = &csvWriter{out: csv.NewWriter(os.Stdout)}
+	case *format == "":
 	default:
-		return ErrNotSupported(ext)
+		return fmt.Errorf("%s: unsupported list format", *format)
 	}
-	hs, err := listHeaders(cmd.Flag.Arg(0), open)
+	if ew != nil {
+		err = walkHeaders(cmd.Flag.Arg(0), sel, input, ew.Write)
+		if err == nil {
+			err = ew.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		return reportMissing(sel)
+	}
+
+	var hs []*tape.Header
+	err = walkHeaders(cmd.Flag.Arg(0), sel, input, func(h *tape.Header) error {
+		hs = append(hs, h)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
@@ -54,39 +88,39 @@ func runList(cmd *cli.Command, args []string) error {
 		if !*iso {
 			return hs[i].Filename < hs[j].Filename
 		}
-		return hs[i].ModTime.Before(hs[i].ModTime)
+		return hs[i].ModTime.Before(hs[j].ModTime)
 	})
-
-	p := Print(*block, *iso)
-	defer p.Flush()
+	p := Print(*unit, *iso)
 	for _, h := range hs {
 		p.Print(h)
 	}
-	return nil
+	p.Flush()
+	return reportMissing(sel)
 }
 
-func listHeaders(file string, open OpenFunc) ([]*tape.Header, error) {
-	f, err := os.Open(file)
+// walkHeaders calls fn for each header of the archive file selected by sel in
+// the order of the archive.
+func walkHeaders(file string, sel *tape.Selection, input *readFlags, fn func(*tape.Header) error) error {
+	r, c, err := input.openArchive(file)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
+	defer c.Close()
 
-	r, err := open(f)
-	if err != nil {
-		return nil, err
-	}
-	var hs []*tape.Header
 	for {
-		switch h, err := r.Next(); err {
-		case nil:
-			hs = append(hs, h)
-			io.Copy(io.Discard, r)
-		case io.EOF:
-			return hs, nil
-		default:
-			return nil, err
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if sel.Match(h.Filename) {
+			if err := fn(h); err != nil {
+				return err
+			}
 		}
+		io.Copy(io.Discard, r)
 	}
 }
 
@@ -97,10 +131,10 @@ type printer struct {
 	coeff int64
 }
 
-func Print(block string, iso bool) *printer {
+func Print(unit string, iso bool) *printer {
 	var p printer
 
-	switch block {
+	switch unit {
 	default:
 		p.coeff = 1
 	case "K", "k":
@@ -136,6 +170,250 @@ func (p *printer) Flush() {
 	p.writer.Flush()
 }
 
+// listEntry holds all the fields of a header in the structured outputs of
+// list.
+type listEntry struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Mode     string            `json:"mode"`
+	Uid      int64             `json:"uid"`
+	Gid      int64             `json:"gid"`
+	User     string            `json:"user"`
+	Group    string            `json:"group"`
+	Size     int64             `json:"size"`
+	ModTime  time.Time         `json:"mtime"`
+	Inode    int64             `json:"inode"`
+	Links    int64             `json:"links"`
+	Major    int64             `json:"devmajor"`
+	Minor    int64             `json:"devminor"`
+	RMajor   int64             `json:"rdevmajor"`
+	RMinor   int64             `json:"rdevminor"`
+	Checksum int64             `json:"checksum"`
+	Link     string            `json:"link,omitempty"`
+	Xattrs   map[string]string `json:"xattrs,omitempty"`
+	Records  map[string]string `json:"records,omitempty"`
+}
+
+var csvColumns = []string{
+	"name",
+	"type",
+	"mode",
+	"uid",
+	"gid",
+	"user",
+	"group",
+	"size",
+	"mtime",
+	"inode",
+	"links",
+	"devmajor",
+	"devminor",
+	"rdevmajor",
+	"rdevminor",
+	"checksum",
+	"link",
+	"xattrs",
+	"records",
+}
+
+// xattrPrefixes are the prefixes of the records holding the extended
+// attributes of a file. The values of the records written by libarchive are
+// base64 encoded.
+var xattrPrefixes = []string{
+	"SCHILY.xattr.",
+	"LIBARCHIVE.xattr.",
+}
+
+func makeListEntry(h *tape.Header) listEntry {
+	e := listEntry{
+		Name:     h.Filename,
+		Type:     fileType(h),
+		Mode:     fmt.Sprintf("%04o", h.Perm()),
+		Uid:      h.Uid,
+		Gid:      h.Gid,
+		User:     h.User(),
+		Group:    h.Group(),
+		Size:     h.Size,
+		ModTime:  h.ModTime.UTC(),
+		Inode:    h.Inode,
+		Links:    h.Links,
+		Major:    h.Major,
+		Minor:    h.Minor,
+		RMajor:   h.RMajor,
+		RMinor:   h.RMinor,
+		Checksum: h.Check,
+		Link:     h.Linkname,
+	}
+	for k, v := range h.Records {
+		name, value, ok := parseXattr(k, v)
+		if !ok {
+			if e.Records == nil {
+				e.Records = make(map[string]string)
+			}
+			e.Records[k] = v
+			continue
+		}
+		if e.Xattrs == nil {
+			e.Xattrs = make(map[string]string)
+		}
+		e.Xattrs[name] = value
+	}
+	return e
+}
+
+func parseXattr(key, value string) (string, string, bool) {
+	for i, p := range xattrPrefixes {
+		if !strings.HasPrefix(key, p) {
+			continue
+		}
+		key = strings.TrimPrefix(key, p)
+		if i == 0 {
+			return key, value, true
+		}
+		if n, err := url.PathUnescape(key); err == nil {
+			key = n
+		}
+		if b, err := base64.StdEncoding.DecodeString(value); err == nil {
+			value = string(b)
+		}
+		return key, value, true
+	}
+	return "", "", false
+}
+
+func (e listEntry) columns() []string {
+	return []string{
+		e.Name,
+		e.Type,
+		e.Mode,
+		strconv.FormatInt(e.Uid, 10),
+		strconv.FormatInt(e.Gid, 10),
+		e.User,
+		e.Group,
+		strconv.FormatInt(e.Size, 10),
+		e.ModTime.Format(time.RFC3339),
+		strconv.FormatInt(e.Inode, 10),
+		strconv.FormatInt(e.Links, 10),
+		strconv.FormatInt(e.Major, 10),
+		strconv.FormatInt(e.Minor, 10),
+		strconv.FormatInt(e.RMajor, 10),
+		strconv.FormatInt(e.RMinor, 10),
+		strconv.FormatInt(e.Checksum, 10),
+		e.Link,
+		jsonColumn(e.Xattrs),
+		jsonColumn(e.Records),
+	}
+}
+
+func jsonColumn(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// entryWriter writes the headers of an archive in one of the structured
+// outputs of list.
+type entryWriter interface {
+	Write(*tape.Header) error
+	Flush() error
+}
+
+// jsonWriter writes the headers as the elements of a JSON array as soon as
+// they are read. The array is closed by Flush.
+type jsonWriter struct {
+	out   io.Writer
+	count int
+}
+
+func (w *jsonWriter) Write(h *tape.Header) error {
+	b, err := json.MarshalIndent(makeListEntry(h), "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if w.count == 0 {
+		sep = "[\n  "
+	}
+	w.count++
+	if _, err := io.WriteString(w.out, sep); err != nil {
+		return err
+	}
+	_, err = w.out.Write(b)
+	return err
+}
+
+func (w *jsonWriter) Flush() error {
+	end := "\n]\n"
+	if w.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.out, end)
+	return err
+}
+
+// ndjsonWriter writes each header as a JSON object on its own line as soon as
+// it is read.
+type ndjsonWriter struct {
+	out *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(h *tape.Header) error {
+	if err := w.enc.Encode(makeListEntry(h)); err != nil {
+		return err
+	}
+	return w.out.Flush()
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.out.Flush()
+}
+
+// csvWriter writes the headers as CSV records preceded by the names of the
+// columns.
+type csvWriter struct {
+	out     *csv.Writer
+	started bool
+}
+
+func (w *csvWriter) Write(h *tape.Header) error {
+	w.start()
+	return w.out.Write(makeListEntry(h).columns())
+}
+
+func (w *csvWriter) Flush() error {
+	w.start()
+	w.out.Flush()
+	return w.out.Error()
+}
+
+func (w *csvWriter) start() {
+	if !w.started {
+		w.out.Write(csvColumns)
+		w.started = true
+	}
+}
+
+// templateWriter executes a template for each header. A newline is written
+// after each header.
+type templateWriter struct {
+	tmpl *template.Template
+	out  *bufio.Writer
+}
+
+func (w *templateWriter) Write(h *tape.Header) error {
+	if err := w.tmpl.Execute(w.out, h); err != nil {
+		return err
+	}
+	return w.out.WriteByte('\n')
+}
+
+func (w *templateWriter) Flush() error {
+	return w.out.Flush()
+}
+
 func parseMode(i int64) []string {
 	var r, w, x int64 = 0x4, 0x2, 0x1
 	vs := make([]string, 3)
@@ -2,47 +2,148 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/midbel/cli"
-	"github.com/midbel/tape"
 )
 
 type ErrNotSupported string
 
 func (e ErrNotSupported) Error() string {
-	v := string(e)
-	if v[0] == '.' {
-		v = v[1:]
+	v := strings.TrimPrefix(string(e), ".")
+	if v == "" {
+		v = "(none)"
 	}
 	return fmt.Sprintf("tape: unsupported archive type %s", v)
 }
 
-type OpenFunc func(io.Reader) (tape.Reader, error)
-
 var commands = []*cli.Command{
 	{
 		Run:   runCreate,
-		Usage: "create [-p] <archive> <file,...>",
+		Usage: "create [-p] [-F format] [-T list [-null]] [-b factor] [-L size] [-reproducible] [-digest algo] [-from-mtree spec] [-V label] [-strip-components n] [-transform expr] [-encrypt] [-key file|-passphrase file] [-cipher cipher] <archive|-> <file,...>",
 		Alias: []string{"make"},
-		Short: "create a new cpio or ar archives",
+		Short: "create a new cpio, ar, tar or iso archives",
+		Desc:  "",
+	},
+	{
+		Run:   runAppend,
+		Usage: "append [-p] <archive> <file,...>",
+		Short: "append files to an existing cpio, ar or tar archive",
+		Desc:  "",
+	},
+	{
+		Run:   runDelete,
+		Usage: "delete [-b factor] <archive> <member,...>",
+		Short: "delete members matching the given patterns from an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runReplace,
+		Usage: "replace [-b factor] <archive> <file,...>",
+		Short: "replace or add members of an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runRename,
+		Usage: "rename [-b factor] <archive> <member> <name>",
+		Alias: []string{"mv"},
+		Short: "rename a member of an archive and the members below it",
+		Desc:  "",
+	},
+	{
+		Run:   runChmod,
+		Usage: "chmod [-b factor] <archive> <mode> <member,...>",
+		Short: "change the permissions of members of an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runChown,
+		Usage: "chown [-b factor] <archive> <owner[:group]> <member,...>",
+		Short: "change the owner of members of an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runVerify,
+		Usage: "verify [-j] [-d] [-b factor] [-encrypt] [-key file|-passphrase file] <archive>",
+		Alias: []string{"compare"},
+		Short: "compare the members of an archive with the files of a directory",
+		Desc:  "",
+	},
+	{
+		Run:   runDiff,
+		Usage: "diff [-u] [-b factor] [-encrypt] [-key file|-passphrase file] <archive> <archive>",
+		Short: "show the differences between two archives",
+		Desc:  "",
+	},
+	{
+		Run:   runManifest,
+		Usage: "manifest [-a algo] [-f sum|mtree|json] [-b factor] [-encrypt] [-key file|-passphrase file] <archive>",
+		Short: "print the digests of the members of an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runMtree,
+		Usage: "mtree [-a algo] [-b factor] [-encrypt] [-key file|-passphrase file] <archive|directory>",
+		Short: "print the mtree specification of an archive or a directory",
+		Desc:  "",
+	},
+	{
+		Run:   runSign,
+		Usage: "sign -k key [-e] <archive>",
+		Short: "sign an archive with an ed25519 key",
+		Desc:  "",
+	},
+	{
+		Run:   runVerifySig,
+		Usage: "verify-sig -k key [-s signature] <archive>",
+		Short: "check the signature of an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runEncrypt,
+		Usage: "encrypt [-c cipher] [-k key] [-passphrase file] <input> <output>",
+		Short: "encrypt an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runDecrypt,
+		Usage: "decrypt [-k key] [-passphrase file] <input> <output>",
+		Short: "decrypt an archive",
+		Desc:  "",
+	},
+	{
+		Run:   runBackup,
+		Usage: "backup -snapshot file [-full] [-keep] [-b factor] <archive> <file,...>",
+		Short: "create an incremental tar archive of the files changed since the last backup",
+		Desc:  "",
+	},
+	{
+		Run:   runRestore,
+		Usage: "restore [-d datadir] [-b factor] [-encrypt] [-key file|-passphrase file] <archive,...>",
+		Short: "restore the archives of a backup, deleting the files removed between them",
+		Desc:  "",
+	},
+	{
+		Run:   runCat,
+		Usage: "cat [-b factor] [-encrypt] [-key file|-passphrase file] [-regex expr] [-exclude pattern] [-files-from file [-null]] <archive|-> [<pattern,...>]",
+		Short: "write the content of the members of an archive to stdout",
 		Desc:  "",
 	},
 	{
 		Run:   runExtract,
-		Usage: "extract [-p] [-d] <archive> <member,...>",
+		Usage: "extract [-p] [-b factor] [-d] [-keep-old-files|-skip-newer|-overwrite|-unlink-first] [-numeric-owner] [-owner user] [-group group] [-uid-map id:hostid:size] [-gid-map id:hostid:size] [-encrypt] [-key file|-passphrase file] [-strip-components n] [-transform expr] [-regex expr] [-exclude pattern] [-files-from file [-null]] <archive|-> [<pattern,...>]",
 		Short: "extract the content of cpio and/or ar archives",
 		Desc:  "",
 	},
 	{
 		Run:   runList,
-		Usage: "list [-b] <archive,...>",
+		Usage: "list [-u K|M|G] [-i] [-b factor] [-format json|csv|ndjson] [-template tmpl] [-encrypt] [-key file|-passphrase file] [-regex expr] [-exclude pattern] [-files-from file [-null]] <archive|-> [<pattern,...>]",
 		Alias: []string{"ls"},
 		Short: "list the content of cpio and/or ar archives",
-		Desc:  "",
+		Desc:  "The unit of the sizes, formerly given with -b, is given with -u. The -b option now\ngives the blocking factor of tar archives.",
 	},
 }
 
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/mtree"
+)
+
+type manifestEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Mode    string    `json:"mode"`
+	Uid     int64     `json:"uid"`
+	Gid     int64     `json:"gid"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Link    string    `json:"link,omitempty"`
+	Digest  string    `json:"digest,omitempty"`
+}
+
+func runManifest(cmd *cli.Command, args []string) error {
+	var (
+		algo   = cmd.Flag.String("a", tape.SHA256, "digest algorithm")
+		format = cmd.Flag.String("f", "sum", "manifest format")
+		input  = addReadFlags(&cmd.Flag)
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	switch *format {
+	case "sum", "mtree", "json":
+	default:
+		return fmt.Errorf("%s: unsupported manifest format", *format)
+	}
+	r, c, err := input.openArchive(cmd.Flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	dr, err := tape.NewDigestReader(r, *algo)
+	if err != nil {
+		return err
+	}
+	var (
+		out     = bufio.NewWriter(os.Stdout)
+		entries = []manifestEntry{}
+	)
+	mt, err := mtree.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	for {
+		h, err := dr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		var sum string
+		if h.IsRegular() && h.Linkname == "" {
+			if _, err := io.CopyN(io.Discard, dr, h.Size); err != nil {
+				return err
+			}
+			sum = dr.Sum()
+		}
+		switch *format {
+		case "sum":
+			if sum != "" {
+				fmt.Fprintf(out, "%s  %s\n", sum, h.Filename)
+			}
+		case "mtree":
+			if sum != "" {
+				x := *h
+				x.Records = map[string]string{tape.DigestPrefix + *algo: sum}
+				h = &x
+			}
+			if err := mt.WriteHeader(h); err != nil {
+				return err
+			}
+		case "json":
+			e := manifestEntry{
+				Name:    h.Filename,
+				Type:    fileType(h),
+				Mode:    fmt.Sprintf("%04o", h.Perm()),
+				Uid:     h.Uid,
+				Gid:     h.Gid,
+				Size:    h.Size,
+				ModTime: h.ModTime.UTC(),
+				Link:    h.Linkname,
+				Digest:  sum,
+			}
+			if sum != "" {
+				e.Digest = *algo + ":" + sum
+			}
+			entries = append(entries, e)
+		}
+	}
+	switch *format {
+	case "mtree":
+		if err := mt.Close(); err != nil {
+			return err
+		}
+	case "json":
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		if err := e.Encode(entries); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
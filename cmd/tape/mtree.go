@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/mtree"
+)
+
+func runMtree(cmd *cli.Command, args []string) error {
+	var (
+		algo  = cmd.Flag.String("a", tape.SHA256, "digest algorithm")
+		input = addReadFlags(&cmd.Flag)
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	w, err := mtree.NewWriter(os.Stdout, *algo)
+	if err != nil {
+		return err
+	}
+	file := cmd.Flag.Arg(0)
+	i, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if i.IsDir() {
+		if err := tape.WriteFS(w, os.DirFS(file), tape.FSOptions{}); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	r, c, err := input.openArchive(file)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := tape.Convert(r, w); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// createFromSpec writes to w the entries described in the mtree specification
+// stored in file. The metadata of the entries come from the specification and
+// only the keywords missing from it are taken from the filesystem, or from
+// opts when the metadata are not preserved.
+func createFromSpec(w tape.Writer, file string, opts tape.FSOptions) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := mtree.NewReader(f)
+	for {
+		e, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			w.Close()
+			return err
+		}
+		if e.Filename == "." {
+			continue
+		}
+		if err := writeSpecEntry(w, e, opts); err != nil {
+			w.Close()
+			return fmt.Errorf("%s: %w", e.Filename, err)
+		}
+	}
+	return w.Close()
+}
+
+// writeSpecEntry writes the entry e to w. The content of the regular files is
+// checked against the digests given in the specification.
+func writeSpecEntry(w tape.Writer, e *mtree.Entry, opts tape.FSOptions) error {
+	file := e.Contents
+	if file == "" {
+		file = filepath.FromSlash(e.Filename)
+	}
+	h := e.Header
+	h.Records = make(map[string]string)
+	for k, v := range e.Records {
+		h.Records[k] = v
+	}
+	if err := fillFromFile(&h, e, file, opts); err != nil {
+		return err
+	}
+	if !h.IsRegular() || h.Linkname != "" {
+		return w.WriteHeader(&h)
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && h.Size == 0 {
+			return w.WriteHeader(&h)
+		}
+		return err
+	}
+	defer r.Close()
+
+	var (
+		sums = make(map[string]hash.Hash)
+		ws   []io.Writer
+	)
+	for k := range h.Records {
+		algo := strings.TrimPrefix(k, tape.DigestPrefix)
+		if algo == k {
+			continue
+		}
+		sum, err := tape.NewHash(algo)
+		if err != nil {
+			return err
+		}
+		sums[algo] = sum
+		ws = append(ws, sum)
+	}
+	src := io.TeeReader(r, io.MultiWriter(ws...))
+	if _, ok := h.Records[tape.DigestPrefix+opts.Digest]; opts.Digest != "" && !ok {
+		err = tape.WriteDigest(w, &h, src, opts.Digest)
+	} else if err = w.WriteHeader(&h); err == nil {
+		_, err = io.CopyN(w, src, h.Size)
+	}
+	if err != nil {
+		return err
+	}
+	for algo, sum := range sums {
+		if got := hex.EncodeToString(sum.Sum(nil)); got != h.Records[tape.DigestPrefix+algo] {
+			return fmt.Errorf("%s digest mismatch", algo)
+		}
+	}
+	return nil
+}
+
+// fillFromFile sets the metadata of h missing from the specification. The
+// owner given by name is only used when the name exists on the host.
+func fillFromFile(h *tape.Header, e *mtree.Entry, file string, opts tape.FSOptions) error {
+	uid, gid := e.Has("uid"), e.Has("gid")
+	if id, err := tape.LookupUid(h.Uname); !uid && h.Uname != "" && err == nil {
+		h.Uid, uid = id, true
+	}
+	if id, err := tape.LookupGid(h.Gname); !gid && h.Gname != "" && err == nil {
+		h.Gid, gid = id, true
+	}
+	if opts.Owner {
+		if !uid {
+			h.Uid, uid = opts.Uid, true
+		}
+		if !gid {
+			h.Gid, gid = opts.Gid, true
+		}
+	}
+	if !opts.ModTime.IsZero() && !e.Has("time") {
+		h.ModTime = opts.ModTime
+	}
+	i, err := os.Lstat(file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || (h.IsRegular() && !e.Has("size")) || (h.IsSymlink() && !e.Has("link")) {
+			return err
+		}
+		if !e.Has("time") && opts.ModTime.IsZero() {
+			h.ModTime = time.Now()
+		}
+		return nil
+	}
+	disk := tape.FileInfoHeaderFromInfo(i)
+	if !e.Has("mode") {
+		h.Mode |= disk.Perm()
+	}
+	if !uid {
+		h.Uid = disk.Uid
+		if h.Uname == "" {
+			h.Uname = disk.Uname
+		}
+	}
+	if !gid {
+		h.Gid = disk.Gid
+		if h.Gname == "" {
+			h.Gname = disk.Gname
+		}
+	}
+	if !e.Has("time") && opts.ModTime.IsZero() {
+		h.ModTime = disk.ModTime
+	}
+	if h.IsRegular() && !e.Has("size") {
+		h.Size = disk.Size
+	}
+	if h.IsSymlink() && !e.Has("link") {
+		if h.Linkname, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+	if h.IsRegular() && h.Size != disk.Size {
+		return fmt.Errorf("size mismatch (spec: %d, file: %d)", h.Size, disk.Size)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+)
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// selectFlags are the options of the commands selecting members of an
+// archive.
+type selectFlags struct {
+	regex     stringList
+	exclude   stringList
+	filesFrom string
+	null      bool
+}
+
+func addSelectFlags(set *flag.FlagSet) *selectFlags {
+	var f selectFlags
+	set.Var(&f.regex, "regex", "select members matching regular expression")
+	set.Var(&f.exclude, "exclude", "exclude members matching pattern")
+	set.StringVar(&f.filesFrom, "files-from", "", "read members to select from file")
+	set.BoolVar(&f.null, "null", false, "NUL separated list of members")
+	return &f
+}
+
+// selection returns the tape.Selection made of the patterns given on the
+// command line and of the options. The names read from the list given by
+// -files-from are not patterns and are matched literally.
+func (f *selectFlags) selection(patterns []string) (*tape.Selection, error) {
+	var s tape.Selection
+	if f.filesFrom != "" {
+		list, err := readFileList(f.filesFrom, f.null)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range list {
+			s.IncludeName(n)
+		}
+	}
+	for _, p := range patterns {
+		if err := s.Include(p); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range f.regex {
+		if err := s.IncludeRegexp(p); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range f.exclude {
+		if err := s.Exclude(p); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// nameFlags are the options of the commands rewriting the names of the
+// entries.
+type nameFlags struct {
+	strip     int
+	transform stringList
+}
+
+func addNameFlags(set *flag.FlagSet) *nameFlags {
+	var f nameFlags
+	set.IntVar(&f.strip, "strip-components", 0, "strip leading components from names")
+	set.Var(&f.transform, "transform", "rewrite names with sed-like substitutions")
+	return &f
+}
+
+// mapper returns the tape.NameMapper made of the options or nil when the
+// names are not rewritten.
+func (f *nameFlags) mapper() (tape.NameMapper, error) {
+	var ms []tape.NameMapper
+	if f.strip > 0 {
+		ms = append(ms, tape.StripComponents(f.strip))
+	}
+	for _, t := range f.transform {
+		m, err := tape.ParseTransform(t)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if len(ms) == 0 {
+		return nil, nil
+	}
+	return tape.ChainNames(ms...), nil
+}
+
+// reportMissing writes the patterns that have not matched any member of the
+// archive to stderr.
+func reportMissing(s *tape.Selection) error {
+	missing := s.Missing()
+	if len(missing) == 0 {
+		return nil
+	}
+	for _, m := range missing {
+		fmt.Fprintf(os.Stderr, "%s: Not found in archive\n", m)
+	}
+	return cli.Exit(fmt.Errorf("%d member(s) not found in archive", len(missing)), 2)
+}
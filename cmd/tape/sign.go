@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/sign"
+	"github.com/midbel/tape/tar"
+)
+
+func runSign(cmd *cli.Command, args []string) error {
+	var (
+		keyfile  = cmd.Flag.String("k", "", "private key")
+		embedded = cmd.Flag.Bool("e", false, "embed signature")
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	key, err := sign.ReadPrivateKey(*keyfile)
+	if err != nil {
+		return err
+	}
+	file := cmd.Flag.Arg(0)
+	if *embedded {
+		create := func(w io.Writer) (tape.Writer, error) {
+			return sign.NewWriter(w, key), nil
+		}
+		return tape.RewriteFile(file, tar.Open, create, tape.Delete(sign.EntryName))
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	sig, err := sign.Sign(r, key)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(file + ".sig")
+	if err != nil {
+		return err
+	}
+	if err := sign.WriteSignature(w, sig); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func runVerifySig(cmd *cli.Command, args []string) error {
+	var (
+		keyfile = cmd.Flag.String("k", "", "public key")
+		sigfile = cmd.Flag.String("s", "", "detached signature")
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	key, err := sign.ReadPublicKey(*keyfile)
+	if err != nil {
+		return err
+	}
+	file := cmd.Flag.Arg(0)
+	if *sigfile == "" {
+		if _, err := os.Stat(file + ".sig"); err == nil {
+			*sigfile = file + ".sig"
+		}
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if *sigfile != "" {
+		err = verifyDetached(r, *sigfile, key)
+	} else {
+		err = verifyEmbedded(r, key)
+	}
+	if err != nil {
+		return cli.Exit(fmt.Errorf("%s: %w", file, err), 1)
+	}
+	fmt.Fprintf(os.Stdout, "%s: signature ok\n", file)
+	return nil
+}
+
+func verifyDetached(r io.Reader, file string, key []byte) error {
+	s, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	sig, err := sign.ReadSignature(s)
+	if err != nil {
+		return err
+	}
+	return sign.Verify(r, key, sig)
+}
+
+func verifyEmbedded(r io.Reader, key []byte) error {
+	sr, err := sign.NewReader(r, tar.Open, key)
+	if err != nil {
+		return err
+	}
+	for {
+		h, err := sr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, sr, h.Size); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/midbel/cli"
+	"github.com/midbel/tape"
+)
+
+type difference struct {
+	Name    string `json:"name"`
+	Field   string `json:"field"`
+	Archive string `json:"archive,omitempty"`
+	Disk    string `json:"disk,omitempty"`
+}
+
+func (d difference) String() string {
+	switch {
+	case d.Field == "missing":
+		return fmt.Sprintf("%s: missing", d.Name)
+	case d.Archive == "" && d.Disk == "":
+		return fmt.Sprintf("%s: %s differs", d.Name, d.Field)
+	}
+	return fmt.Sprintf("%s: %s differs (archive: %s, disk: %s)", d.Name, d.Field, d.Archive, d.Disk)
+}
+
+func runVerify(cmd *cli.Command, args []string) error {
+	var (
+		datadir = cmd.Flag.String("d", ".", "datadir")
+		asJSON  = cmd.Flag.Bool("j", false, "json")
+		input   = addReadFlags(&cmd.Flag)
+	)
+	if err := cmd.Flag.Parse(args); err != nil {
+		return err
+	}
+	r, c, err := input.openArchive(cmd.Flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	diffs, err := verifyArchive(r, *datadir)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if diffs == nil {
+			diffs = []difference{}
+		}
+		if err := e.Encode(diffs); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diffs {
+			fmt.Fprintln(os.Stdout, d)
+		}
+	}
+	if len(diffs) > 0 {
+		return cli.Exit(fmt.Errorf("%s: %d difference(s) found", cmd.Flag.Arg(0), len(diffs)), 1)
+	}
+	return nil
+}
+
+func verifyArchive(r tape.Reader, datadir string) ([]difference, error) {
+	var diffs []difference
+	for {
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		ds, err := verifyEntry(r, h, datadir)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, ds...)
+	}
+	return diffs, nil
+}
+
+func verifyEntry(r io.Reader, h *tape.Header, datadir string) ([]difference, error) {
+	var (
+		file  = filepath.Join(datadir, h.Filename)
+		diffs []difference
+	)
+	report := func(field, archive, disk string) {
+		d := difference{
+			Name:    h.Filename,
+			Field:   field,
+			Archive: archive,
+			Disk:    disk,
+		}
+		diffs = append(diffs, d)
+	}
+	i, err := os.Lstat(file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		report("missing", "", "")
+		return diffs, nil
+	}
+	disk := tape.FileInfoHeaderFromInfo(i)
+	if a, d := h.Mode&tape.ModeType, disk.Mode&tape.ModeType; a != d && !(h.IsRegular() && disk.IsRegular()) {
+		report("type", fileType(h), fileType(disk))
+		return diffs, nil
+	}
+	if h.Perm() != disk.Perm() {
+		report("mode", fmt.Sprintf("%04o", h.Perm()), fmt.Sprintf("%04o", disk.Perm()))
+	}
+	if h.Uid != disk.Uid || h.Gid != disk.Gid {
+		report("owner", fmt.Sprintf("%d:%d", h.Uid, h.Gid), fmt.Sprintf("%d:%d", disk.Uid, disk.Gid))
+	}
+	if h.ModTime.Unix() != disk.ModTime.Unix() {
+		report("mtime", h.ModTime.UTC().Format(time.RFC3339), disk.ModTime.UTC().Format(time.RFC3339))
+	}
+	switch {
+	case h.IsSymlink():
+		link, err := os.Readlink(file)
+		if err != nil {
+			return nil, err
+		}
+		if h.Linkname != link {
+			report("link", h.Linkname, link)
+		}
+	case h.IsRegular() && h.Linkname != "":
+		other, err := os.Lstat(filepath.Join(datadir, h.Linkname))
+		if err != nil || !os.SameFile(i, other) {
+			report("hard link", h.Linkname, "")
+		}
+	case h.IsRegular():
+		if h.Size != disk.Size {
+			report("size", fmt.Sprint(h.Size), fmt.Sprint(disk.Size))
+			break
+		}
+		same, err := sameContent(r, file, h.Size)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			report("content", "", "")
+		}
+	}
+	return diffs, nil
+}
+
+func sameContent(r io.Reader, file string, size int64) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var (
+		archive = sha256.New()
+		disk    = sha256.New()
+	)
+	if _, err := io.CopyN(archive, r, size); err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(disk, f); err != nil {
+		return false, err
+	}
+	return bytes.Equal(archive.Sum(nil), disk.Sum(nil)), nil
+}
+
+func fileType(h *tape.Header) string {
+	switch h.Mode & tape.ModeType {
+	case tape.ModeDir:
+		return "directory"
+	case tape.ModeSymlink:
+		return "symlink"
+	case tape.ModeChar:
+		return "character device"
+	case tape.ModeBlock:
+		return "block device"
+	case tape.ModeFifo:
+		return "fifo"
+	case tape.ModeSocket:
+		return "socket"
+	default:
+		return "file"
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"compress/gzip"
-	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"flag"
@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/midbel/tape"
 	"github.com/midbel/tape/tar"
 )
 
@@ -66,7 +67,11 @@ func createArchive(file string, list []string) error {
 			return err
 		}
 		if h.Type == tar.TypeReg {
-			h.PaxHeaders["midbel.checksum"] = checksum(i)
+			sum, err := checksum(i)
+			if err != nil {
+				return err
+			}
+			h.PaxHeaders[tape.DigestPrefix+tape.SHA256] = sum
 		}
 		h.PaxHeaders["atime"] = "0" //strconv.FormatInt(now, 10)
 		h.PaxHeaders["mtime"] = "0" //strconv.FormatInt(now, 10)
@@ -92,9 +97,18 @@ func copyFile(w io.Writer, file string) error {
 	return err
 }
 
-func checksum(file string) string {
-	sum := sha1.Sum([]byte(file))
-	return hex.EncodeToString(sum[:])
+func checksum(file string) (string, error) {
+	r, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
 }
 
 func readAPK(r io.Reader) error {
@@ -0,0 +1,220 @@
+package tape
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const spoolLimit = 1 << 20
+
+type stage struct {
+	Edit
+	transform bool
+}
+
+type converter struct {
+	stages []stage
+}
+
+type Option func(*converter)
+
+// Filter keeps only the entries for which keep returns true.
+func Filter(keep func(*Header) bool) Option {
+	return WithEdits(EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+		if !keep(h) {
+			return nil, r, nil
+		}
+		return h, r, nil
+	}))
+}
+
+// MapHeader calls fn to modify the header of each entry.
+func MapHeader(fn func(*Header) error) Option {
+	return WithEdits(EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+		return h, r, fn(h)
+	}))
+}
+
+// StripPrefix removes prefix from the names of the entries. The entries that
+// are not below prefix are left untouched while the one named prefix is
+// removed.
+func StripPrefix(prefix string) Option {
+	prefix = CleanName(prefix)
+	return WithEdits(EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+		name := CleanName(h.Filename)
+		if name == prefix {
+			return nil, r, nil
+		}
+		if strings.HasPrefix(name, prefix+"/") {
+			h.Filename = strings.TrimPrefix(name, prefix+"/")
+		}
+		return h, r, nil
+	}))
+}
+
+// Owner sets the owner of all the entries.
+func Owner(uid, gid int64) Option {
+	return MapHeader(func(h *Header) error {
+		h.Uid, h.Gid = uid, gid
+		h.Uname, h.Gname = userName(uid), groupName(gid)
+		return nil
+	})
+}
+
+// ClampTime sets the modification time of the entries modified after when to
+// when.
+func ClampTime(when time.Time) Option {
+	return MapHeader(func(h *Header) error {
+		if h.ModTime.After(when) {
+			h.ModTime = when
+		}
+		return nil
+	})
+}
+
+// Transform calls fn to transform the content of the regular files. Since the
+// size of the transformed content is only known once it has been completely
+// read, it is spooled in memory, or in a temporary file when it is too large,
+// before being written.
+func Transform(fn func(*Header, io.Reader) (io.Reader, error)) Option {
+	return func(c *converter) {
+		e := EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+			if !h.IsRegular() || h.Linkname != "" {
+				return h, r, nil
+			}
+			r, err := fn(h, r)
+			return h, r, err
+		})
+		c.stages = append(c.stages, stage{Edit: e, transform: true})
+	}
+}
+
+// WithEdits applies the given edits to each entry.
+func WithEdits(edits ...Edit) Option {
+	return func(c *converter) {
+		for _, e := range edits {
+			c.stages = append(c.stages, stage{Edit: e})
+		}
+	}
+}
+
+// ConvertWith copies the entries of r to w like Convert, passing them through
+// the given options in order.
+func ConvertWith(r Reader, w Writer, options ...Option) error {
+	var c converter
+	for _, o := range options {
+		o(&c)
+	}
+	for {
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if err := c.convert(w, h, r); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.stages {
+		f, ok := s.Edit.(finisher)
+		if !ok {
+			continue
+		}
+		if err := f.finish(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *converter) convert(w Writer, h *Header, r io.Reader) error {
+	var (
+		x         = *h
+		hdr       = &x
+		content   = io.LimitReader(r, h.Size)
+		transform bool
+		err       error
+	)
+	defer func() {
+		if cl, ok := content.(io.Closer); ok {
+			cl.Close()
+		}
+	}()
+	for _, s := range c.stages {
+		if hdr, content, err = s.Apply(hdr, content); err != nil {
+			return err
+		}
+		if hdr == nil {
+			return nil
+		}
+		transform = transform || s.transform
+	}
+	if !transform || !hdr.IsRegular() {
+		return writeContent(w, hdr, content)
+	}
+	var s spool
+	defer s.Close()
+	if hdr.Size, err = io.Copy(&s, content); err != nil {
+		return err
+	}
+	rs, err := s.Reader()
+	if err != nil {
+		return err
+	}
+	return writeContent(w, hdr, rs)
+}
+
+func writeContent(w Writer, h *Header, r io.Reader) error {
+	if err := w.WriteHeader(h); err != nil {
+		return err
+	}
+	if h.Size == 0 {
+		return nil
+	}
+	_, err := io.CopyN(w, r, h.Size)
+	return err
+}
+
+type spool struct {
+	buf  bytes.Buffer
+	file *os.File
+}
+
+func (s *spool) Write(b []byte) (int, error) {
+	if s.file == nil && s.buf.Len()+len(b) > spoolLimit {
+		f, err := os.CreateTemp("", "tape-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := s.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+	if s.file != nil {
+		return s.file.Write(b)
+	}
+	return s.buf.Write(b)
+}
+
+func (s *spool) Reader() (io.Reader, error) {
+	if s.file == nil {
+		return &s.buf, nil
+	}
+	_, err := s.file.Seek(0, io.SeekStart)
+	return s.file, err
+}
+
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"time"
 
@@ -43,15 +44,61 @@ func NewWriter(w io.Writer) *Writer {
 	return &ws
 }
 
+// Create returns a tape.Writer writing a cpio archive to w.
+func Create(w io.Writer) (tape.Writer, error) {
+	return NewWriter(w), nil
+}
+
+// OpenAppend prepares the cpio archive stored in f to receive new entries. The
+// trailer is removed and the returned Writer starts writing where it was.
+func OpenAppend(f *os.File) (*Writer, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := NewReader(f)
+	for {
+		_, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+	}
+	end, _ := r.Offset()
+	if err := f.Truncate(end); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	ws := Writer{
+		inner:  f,
+		blocks: end,
+	}
+	return &ws, nil
+}
+
 func (w *Writer) WriteHeader(h *tape.Header) error {
 	if w.err = w.Flush(); w.err != nil {
 		return w.err
 	}
-	if w.err = w.writeHeader(h, false); w.err != nil {
+	var (
+		x    = *h
+		link string
+	)
+	if x.IsSymlink() && x.Size == 0 {
+		link = x.Linkname
+		x.Size = int64(len(link))
+	}
+	if w.err = w.writeHeader(&x, false); w.err != nil {
 		return w.err
 	}
-	w.size = int(h.Size)
-	w.curr = tape.LimitWriter(w.inner, h.Size)
+	w.size = int(x.Size)
+	w.curr = tape.LimitWriter(w.inner, x.Size)
+	if link != "" {
+		_, w.err = io.WriteString(w, link)
+	}
 	return w.err
 }
 
@@ -103,8 +150,8 @@ func (w *Writer) writeHeader(h *tape.Header, trailing bool) error {
 		buf bytes.Buffer
 		siz = int64(len(h.Filename)) + 1
 	)
-	if !trailing {
-		h.Mode |= 1 << 15
+	if !trailing && h.Mode&tape.ModeType == 0 {
+		h.Mode |= tape.ModeRegular
 	}
 	buf.Write(magicASCII)
 	writeHeaderInt(&buf, h.Inode)
@@ -146,17 +193,37 @@ type Reader struct {
 	inner *bufio.Reader
 	curr  io.Reader
 	err   error
+	count *counter
 
 	read int
 	size int
+
+	header int64
+	data   int64
 }
 
 func NewReader(r io.Reader) *Reader {
+	c := counter{
+		Reader: r,
+	}
 	return &Reader{
-		inner: bufio.NewReader(r),
+		inner: bufio.NewReader(&c),
+		count: &c,
 	}
 }
 
+// Open returns a tape.Reader for the cpio archive read from r.
+func Open(r io.Reader) (tape.Reader, error) {
+	return NewReader(r), nil
+}
+
+// Offset returns the positions of the header and of the data of the current
+// entry in the underlying stream. After Next has returned io.EOF, the header
+// position is the one of the trailer.
+func (r *Reader) Offset() (int64, int64) {
+	return r.header, r.data
+}
+
 func (r *Reader) Read(bs []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
@@ -181,16 +248,26 @@ func (r *Reader) Next() (*tape.Header, error) {
 		return nil, r.err
 	}
 	if r.curr != nil {
-		io.Copy(io.Discard, r.curr)
+		n, _ := io.Copy(io.Discard, r.curr)
+		r.read += int(n)
+		r.discard(r.read)
+		r.curr = nil
 	}
+	r.header = r.position()
 	h, err := r.next()
 	if err != nil {
 		r.err = err
 		return nil, r.err
 	}
+	r.data = r.position()
 	if h.Filename == trailer {
 		return nil, io.EOF
 	}
+	if h.IsSymlink() {
+		if b, err := r.inner.Peek(int(h.Size)); err == nil {
+			h.Linkname = string(b)
+		}
+	}
 	r.size = int(h.Size)
 	r.read = 0
 	r.curr = io.LimitReader(r.inner, h.Size)
@@ -233,6 +310,21 @@ func (r *Reader) discard(n int) error {
 	return err
 }
 
+func (r *Reader) position() int64 {
+	return r.count.N - int64(r.inner.Buffered())
+}
+
+type counter struct {
+	io.Reader
+	N int64
+}
+
+func (c *counter) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	c.N += int64(n)
+	return n, err
+}
+
 func readMagic(r io.Reader) error {
 	b := make([]byte, magicLen)
 	if _, err := io.ReadFull(r, b); err != nil {
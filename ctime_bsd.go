@@ -0,0 +1,20 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package tape
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// ChangeTime returns the time of the last change of the status of the file
+// described by fi. The modification time is returned when it is not known.
+func ChangeTime(fi fs.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(st.Ctimespec.Unix())
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package tape
+
+import (
+	"io/fs"
+	"time"
+)
+
+// ChangeTime returns the modification time of the file described by fi since
+// the time of the last change of its status is not known on this system.
+func ChangeTime(fi fs.FileInfo) time.Time {
+	return fi.ModTime()
+}
@@ -0,0 +1,79 @@
+package tape
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	SHA256  = "sha256"
+	SHA512  = "sha512"
+	BLAKE2b = "blake2b"
+)
+
+// DigestPrefix is the prefix of the records holding the digest of the content
+// of an entry. The name of the algorithm is appended to it.
+const DigestPrefix = "midbel.checksum."
+
+// NewHash returns a new hash.Hash computing the digest named algo.
+func NewHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case BLAKE2b:
+		return blake2b.New512(nil)
+	default:
+		return nil, fmt.Errorf("%s: %w digest", algo, ErrUnsupported)
+	}
+}
+
+// DigestReader computes the digest of the content of each entry while it is
+// read.
+type DigestReader struct {
+	Reader
+
+	algo string
+	hash hash.Hash
+}
+
+func NewDigestReader(r Reader, algo string) (*DigestReader, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+	dr := DigestReader{
+		Reader: r,
+		algo:   algo,
+		hash:   h,
+	}
+	return &dr, nil
+}
+
+func (r *DigestReader) Next() (*Header, error) {
+	r.hash.Reset()
+	return r.Reader.Next()
+}
+
+func (r *DigestReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.hash.Write(b[:n])
+	return n, err
+}
+
+// Sum returns the hex encoded digest of the content of the current entry read
+// so far.
+func (r *DigestReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// Algorithm returns the name of the digest computed by r.
+func (r *DigestReader) Algorithm() string {
+	return r.algo
+}
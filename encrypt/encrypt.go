@@ -0,0 +1,445 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/midbel/tape"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Cipher identifies the AEAD used to encrypt the chunks of a stream.
+type Cipher byte
+
+const (
+	AES256GCM Cipher = iota + 1
+	ChaCha20Poly1305
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case AES256GCM:
+		return "aes-256-gcm"
+	case ChaCha20Poly1305:
+		return "chacha20-poly1305"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	kdfNone byte = iota
+	kdfScrypt
+)
+
+const (
+	version    = 1
+	KeySize    = 32
+	saltLen    = 16
+	prefixLen  = 7
+	nonceLen   = prefixLen + 4 + 1
+	ChunkSize  = 64 << 10
+	lastChunk  = 1 << 31
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	// limits of the parameters read from a stream, so a forged header can not
+	// make a Reader allocate too much memory.
+	maxScryptLogN  = 20
+	maxScryptRP    = 32
+	maxChunkSize   = 16 << 20
+	maxChunkNumber = math.MaxUint32
+)
+
+var magic = []byte("TENC")
+
+var (
+	ErrMagic     = errors.New("encrypt: invalid magic")
+	ErrVersion   = errors.New("encrypt: unsupported version")
+	ErrKey       = errors.New("encrypt: invalid key")
+	ErrAuth      = errors.New("encrypt: message authentication failed")
+	ErrTruncated = errors.New("encrypt: truncated stream")
+	ErrTrailing  = errors.New("encrypt: data after the last chunk")
+	ErrTooLarge  = errors.New("encrypt: too many chunks in stream")
+)
+
+// params are written at the beginning of the stream. They are authenticated
+// with each chunk.
+type params struct {
+	cipher Cipher
+	kdf    byte
+	logN   byte
+	r      byte
+	p      byte
+	salt   []byte
+	prefix []byte
+	chunk  uint32
+}
+
+func (p params) encode() []byte {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	buf.WriteByte(version)
+	buf.WriteByte(byte(p.cipher))
+	buf.WriteByte(p.kdf)
+	if p.kdf == kdfScrypt {
+		buf.Write([]byte{p.logN, p.r, p.p})
+		buf.Write(p.salt)
+	}
+	buf.Write(p.prefix)
+	binary.Write(&buf, binary.BigEndian, p.chunk)
+	return buf.Bytes()
+}
+
+func readParams(r io.Reader) (params, []byte, error) {
+	var (
+		p   params
+		buf bytes.Buffer
+		rs  = io.TeeReader(r, &buf)
+		hdr = make([]byte, len(magic)+3)
+	)
+	if _, err := io.ReadFull(rs, hdr); err != nil {
+		return p, nil, err
+	}
+	if !bytes.Equal(hdr[:len(magic)], magic) {
+		return p, nil, ErrMagic
+	}
+	if hdr[len(magic)] != version {
+		return p, nil, ErrVersion
+	}
+	p.cipher = Cipher(hdr[len(magic)+1])
+	p.kdf = hdr[len(magic)+2]
+	switch p.kdf {
+	case kdfNone:
+	case kdfScrypt:
+		b := make([]byte, 3+saltLen)
+		if _, err := io.ReadFull(rs, b); err != nil {
+			return p, nil, err
+		}
+		p.logN, p.r, p.p, p.salt = b[0], b[1], b[2], b[3:]
+		if p.logN == 0 || p.logN > maxScryptLogN || p.r == 0 || p.p == 0 || int(p.r)*int(p.p) > maxScryptRP {
+			return p, nil, fmt.Errorf("%w: invalid scrypt parameters", ErrKey)
+		}
+	default:
+		return p, nil, fmt.Errorf("%w: unknown key derivation", ErrKey)
+	}
+	p.prefix = make([]byte, prefixLen)
+	if _, err := io.ReadFull(rs, p.prefix); err != nil {
+		return p, nil, err
+	}
+	if err := binary.Read(rs, binary.BigEndian, &p.chunk); err != nil {
+		return p, nil, err
+	}
+	if p.chunk == 0 || p.chunk > maxChunkSize {
+		return p, nil, fmt.Errorf("%w: invalid chunk size", ErrMagic)
+	}
+	return p, buf.Bytes(), nil
+}
+
+func (p params) key(secret []byte) ([]byte, error) {
+	if p.kdf == kdfNone {
+		if len(secret) != KeySize {
+			return nil, ErrKey
+		}
+		return secret, nil
+	}
+	return scrypt.Key(secret, p.salt, 1<<p.logN, int(p.r), int(p.p), KeySize)
+}
+
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case AES256GCM:
+		b, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(b)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("encrypt: unsupported cipher %d", c)
+	}
+}
+
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+	n := make([]byte, nonceLen)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixLen:], counter)
+	if last {
+		n[nonceLen-1] = 1
+	}
+	return n
+}
+
+// Writer encrypts the data written to it in chunks. Each chunk is sealed with
+// a nonce made of a random prefix, the position of the chunk in the stream
+// and a flag marking the last chunk, so a Reader can detect chunks that have
+// been removed, reordered or appended. The last chunk is written by Close.
+type Writer struct {
+	inner io.Writer
+	err   error
+
+	aead    cipher.AEAD
+	params  params
+	header  []byte
+	buf     []byte
+	counter uint32
+}
+
+// NewWriter returns a Writer encrypting the stream with key that should be
+// KeySize bytes long.
+func NewWriter(w io.Writer, c Cipher, key []byte) (*Writer, error) {
+	if len(key) != KeySize {
+		return nil, ErrKey
+	}
+	p := params{
+		cipher: c,
+		kdf:    kdfNone,
+	}
+	return newWriter(w, p, key)
+}
+
+// NewPassphraseWriter returns a Writer encrypting the stream with a key
+// derived from passphrase with scrypt.
+func NewPassphraseWriter(w io.Writer, c Cipher, passphrase []byte) (*Writer, error) {
+	p := params{
+		cipher: c,
+		kdf:    kdfScrypt,
+		logN:   scryptLogN,
+		r:      scryptR,
+		p:      scryptP,
+		salt:   make([]byte, saltLen),
+	}
+	if _, err := rand.Read(p.salt); err != nil {
+		return nil, err
+	}
+	return newWriter(w, p, passphrase)
+}
+
+func newWriter(w io.Writer, p params, secret []byte) (*Writer, error) {
+	p.chunk = ChunkSize
+	p.prefix = make([]byte, prefixLen)
+	if _, err := rand.Read(p.prefix); err != nil {
+		return nil, err
+	}
+	key, err := p.key(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(p.cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	ws := Writer{
+		inner:  w,
+		aead:   aead,
+		params: p,
+		header: p.encode(),
+		buf:    make([]byte, 0, p.chunk),
+	}
+	_, ws.err = w.Write(ws.header)
+	return &ws, ws.err
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		if w.err != nil {
+			return n, w.err
+		}
+		if len(w.buf) == cap(w.buf) {
+			w.err = w.seal(false)
+			continue
+		}
+		z := copy(w.buf[len(w.buf):cap(w.buf)], b)
+		w.buf = w.buf[:len(w.buf)+z]
+		b = b[z:]
+		n += z
+	}
+	return n, nil
+}
+
+// Close writes the last chunk of the stream. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.err = w.seal(true); w.err != nil {
+		return w.err
+	}
+	w.err = tape.ErrClosed
+	return nil
+}
+
+func (w *Writer) seal(last bool) error {
+	if w.counter == maxChunkNumber && !last {
+		return ErrTooLarge
+	}
+	var (
+		size = uint32(len(w.buf) + w.aead.Overhead())
+		data = w.aead.Seal(nil, nonce(w.params.prefix, w.counter, last), w.buf, w.header)
+	)
+	if last {
+		size |= lastChunk
+	}
+	if err := binary.Write(w.inner, binary.BigEndian, size); err != nil {
+		return err
+	}
+	if _, err := w.inner.Write(data); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Reader decrypts a stream written by a Writer.
+type Reader struct {
+	inner io.Reader
+	err   error
+
+	aead    cipher.AEAD
+	params  params
+	header  []byte
+	buf     []byte
+	counter uint32
+	done    bool
+}
+
+// NewReader returns a Reader decrypting the stream read from r with key.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	return newReader(r, key, false)
+}
+
+// NewPassphraseReader returns a Reader decrypting the stream read from r with
+// a key derived from passphrase.
+func NewPassphraseReader(r io.Reader, passphrase []byte) (*Reader, error) {
+	return newReader(r, passphrase, true)
+}
+
+func newReader(r io.Reader, secret []byte, passphrase bool) (*Reader, error) {
+	p, header, err := readParams(r)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != (p.kdf == kdfScrypt) {
+		return nil, fmt.Errorf("%w: stream not encrypted with a %s", ErrKey, keyKind(p.kdf))
+	}
+	key, err := p.key(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(p.cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	rs := Reader{
+		inner:  r,
+		aead:   aead,
+		params: p,
+		header: header,
+	}
+	return &rs, nil
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			r.err = r.checkEnd()
+			continue
+		}
+		r.err = r.open()
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) open() error {
+	var size uint32
+	if err := binary.Read(r.inner, binary.BigEndian, &size); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrTruncated
+		}
+		return err
+	}
+	last := size&lastChunk != 0
+	size &^= lastChunk
+	if r.counter == maxChunkNumber && !last {
+		return ErrTooLarge
+	}
+	if size < uint32(r.aead.Overhead()) || size > r.params.chunk+uint32(r.aead.Overhead()) {
+		return ErrAuth
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.inner, data); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrTruncated
+		}
+		return err
+	}
+	plain, err := r.aead.Open(data[:0], nonce(r.params.prefix, r.counter, last), data, r.header)
+	if err != nil {
+		return ErrAuth
+	}
+	r.counter++
+	r.buf = plain
+	r.done = last
+	return nil
+}
+
+func (r *Reader) checkEnd() error {
+	var b [1]byte
+	switch _, err := io.ReadFull(r.inner, b[:]); {
+	case errors.Is(err, io.EOF):
+		return io.EOF
+	case err != nil:
+		return err
+	default:
+		return ErrTrailing
+	}
+}
+
+// Cipher returns the cipher used to encrypt the stream.
+func (r *Reader) Cipher() Cipher {
+	return r.params.cipher
+}
+
+// ReadKeyFile reads a raw key from file. The key is either stored as is or
+// hex encoded.
+func ReadKeyFile(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == KeySize {
+		return b, nil
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(b)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("%s: %w", file, ErrKey)
+	}
+	return key, nil
+}
+
+func keyKind(kdf byte) string {
+	if kdf == kdfScrypt {
+		return "key file"
+	}
+	return "passphrase"
+}
@@ -0,0 +1,251 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{0x2a}, KeySize)
+
+func TestRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, ChunkSize - 1, ChunkSize, 3*ChunkSize + 17}
+	for _, c := range []Cipher{AES256GCM, ChaCha20Poly1305} {
+		for _, size := range sizes {
+			plain := randomData(size)
+
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, c, testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeAll(t, w, plain)
+			r, err := NewReader(&buf, testKey)
+			if err != nil {
+				t.Fatalf("%s/%d: %s", c, size, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s/%d: %s", c, size, err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("%s/%d: content mismatch", c, size)
+			}
+			if r.Cipher() != c {
+				t.Errorf("%s/%d: want cipher %s, got %s", c, size, c, r.Cipher())
+			}
+		}
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		plain = randomData(ChunkSize + 10)
+		pass  = []byte("correct horse battery staple")
+	)
+	w, err := NewPassphraseWriter(&buf, ChaCha20Poly1305, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAll(t, w, plain)
+	stream := buf.Bytes()
+
+	if _, err := NewReader(bytes.NewReader(stream), testKey); !errors.Is(err, ErrKey) {
+		t.Errorf("key on passphrase stream: want %v, got %v", ErrKey, err)
+	}
+	r, err := NewPassphraseReader(bytes.NewReader(stream), []byte("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrAuth) {
+		t.Errorf("wrong passphrase: want %v, got %v", ErrAuth, err)
+	}
+	r, err = NewPassphraseReader(bytes.NewReader(stream), pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("content mismatch")
+	}
+}
+
+func TestTamper(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, AES256GCM, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAll(t, w, randomData(2*ChunkSize+100))
+
+	var (
+		stream = buf.Bytes()
+		header = len(w.header)
+		chunks = splitChunks(t, stream[header:])
+	)
+	if len(chunks) != 3 {
+		t.Fatalf("want 3 chunks, got %d", len(chunks))
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{stream[:header]}, parts...), nil)
+	}
+	data := []struct {
+		Name   string
+		Stream []byte
+		Err    error
+	}{
+		{
+			Name:   "last chunk removed",
+			Stream: join(chunks[0], chunks[1]),
+			Err:    ErrTruncated,
+		},
+		{
+			Name:   "cut in chunk",
+			Stream: join(chunks[0], chunks[1][:100]),
+			Err:    ErrTruncated,
+		},
+		{
+			Name:   "chunks reordered",
+			Stream: join(chunks[1], chunks[0], chunks[2]),
+			Err:    ErrAuth,
+		},
+		{
+			Name:   "chunk removed",
+			Stream: join(chunks[0], chunks[2]),
+			Err:    ErrAuth,
+		},
+		{
+			Name:   "chunk duplicated",
+			Stream: join(chunks[0], chunks[0], chunks[1], chunks[2]),
+			Err:    ErrAuth,
+		},
+		{
+			Name:   "data appended",
+			Stream: append(join(chunks...), 0),
+			Err:    ErrTrailing,
+		},
+		{
+			Name:   "chunk appended",
+			Stream: join(chunks[0], chunks[1], chunks[2], chunks[2]),
+			Err:    ErrTrailing,
+		},
+		{
+			Name:   "ciphertext modified",
+			Stream: flip(join(chunks...), header+4+10),
+			Err:    ErrAuth,
+		},
+		{
+			Name:   "last flag cleared",
+			Stream: flip(join(chunks...), header+len(chunks[0])+len(chunks[1])),
+			Err:    ErrAuth,
+		},
+		{
+			Name:   "nonce prefix modified",
+			Stream: flip(join(chunks...), header-5),
+			Err:    ErrAuth,
+		},
+		{
+			Name:   "chunk size modified",
+			Stream: flip(join(chunks...), header-1),
+			Err:    ErrAuth,
+		},
+	}
+	for _, d := range data {
+		r, err := NewReader(bytes.NewReader(d.Stream), testKey)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if !errors.Is(err, d.Err) {
+			t.Errorf("%s: want %v, got %v", d.Name, d.Err, err)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	valid := params{
+		cipher: AES256GCM,
+		kdf:    kdfScrypt,
+		logN:   scryptLogN,
+		r:      scryptR,
+		p:      scryptP,
+		salt:   make([]byte, saltLen),
+		prefix: make([]byte, prefixLen),
+		chunk:  ChunkSize,
+	}
+	data := []struct {
+		Name   string
+		Change func(*params)
+		Err    error
+	}{
+		{Name: "valid", Change: func(p *params) {}},
+		{Name: "large logN", Change: func(p *params) { p.logN = maxScryptLogN + 1 }, Err: ErrKey},
+		{Name: "zero logN", Change: func(p *params) { p.logN = 0 }, Err: ErrKey},
+		{Name: "large r*p", Change: func(p *params) { p.r, p.p = 16, 4 }, Err: ErrKey},
+		{Name: "zero p", Change: func(p *params) { p.p = 0 }, Err: ErrKey},
+		{Name: "zero chunk", Change: func(p *params) { p.chunk = 0 }, Err: ErrMagic},
+		{Name: "large chunk", Change: func(p *params) { p.chunk = maxChunkSize + 1 }, Err: ErrMagic},
+		{Name: "unknown kdf", Change: func(p *params) { p.kdf = 9 }, Err: ErrKey},
+	}
+	for _, d := range data {
+		p := valid
+		d.Change(&p)
+		_, _, err := readParams(bytes.NewReader(p.encode()))
+		if !errors.Is(err, d.Err) {
+			t.Errorf("%s: want %v, got %v", d.Name, d.Err, err)
+		}
+	}
+}
+
+func TestCounterWrap(t *testing.T) {
+	w, err := NewWriter(io.Discard, AES256GCM, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.counter = maxChunkNumber
+	if _, err := w.Write(randomData(ChunkSize + 1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("want %v, got %v", ErrTooLarge, err)
+	}
+}
+
+func writeAll(t *testing.T, w *Writer, data []byte) {
+	t.Helper()
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// splitChunks splits the encrypted chunks of stream, each one with its size.
+func splitChunks(t *testing.T, stream []byte) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	for len(stream) > 0 {
+		if len(stream) < 4 {
+			t.Fatalf("invalid stream")
+		}
+		size := int(binary.BigEndian.Uint32(stream) &^ lastChunk)
+		chunks = append(chunks, stream[:4+size])
+		stream = stream[4+size:]
+	}
+	return chunks
+}
+
+func flip(b []byte, i int) []byte {
+	b[i] ^= 0x80
+	return b
+}
+
+func randomData(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
@@ -0,0 +1,356 @@
+package tape
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxLinks = 40
+
+type fsNode struct {
+	header Header
+	offset int64
+	nodes  map[string]*fsNode
+}
+
+func (n *fsNode) names() []string {
+	var ns []string
+	for k := range n.nodes {
+		ns = append(ns, k)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+type archiveFS struct {
+	source io.ReaderAt
+	root   *fsNode
+}
+
+// FS returns a fs.FS giving access to the entries of the archive available in
+// r. The archive is scanned once with the reader returned by open that must
+// implement Offsetter. Directories missing from the archive are synthesized
+// from the names of the entries.
+//
+// The returned value also implements fs.ReadDirFS, fs.StatFS and
+// fs.ReadFileFS.
+func FS(r io.ReaderAt, open OpenFunc) (fs.FS, error) {
+	rs, err := open(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	off, ok := rs.(Offsetter)
+	if !ok {
+		return nil, fmt.Errorf("%w: reader can not report offsets", ErrUnsupported)
+	}
+	afs := archiveFS{
+		source: r,
+		root: &fsNode{
+			header: Header{
+				Filename: ".",
+				Mode:     ModeDir | 0755,
+			},
+			nodes: make(map[string]*fsNode),
+		},
+	}
+	for {
+		h, err := rs.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		_, data := off.Offset()
+		afs.insert(h, data)
+	}
+	return &afs, nil
+}
+
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	n, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := archiveFile{
+		node: n,
+		name: name,
+	}
+	if !n.header.IsDir() {
+		f.SectionReader = io.NewSectionReader(a.source, n.offset, n.header.Size)
+	}
+	return &f, nil
+}
+
+func (a *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := a.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.header.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return readDir(n, n.names()), nil
+}
+
+func (a *archiveFS) ReadFile(name string) ([]byte, error) {
+	n, err := a.lookup("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.header.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	buf := make([]byte, n.header.Size)
+	if _, err := a.source.ReadAt(buf, n.offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return buf, nil
+}
+
+func (a *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	n, err := a.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{node: n}, nil
+}
+
+func (a *archiveFS) Lstat(name string) (fs.FileInfo, error) {
+	n, err := a.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{node: n}, nil
+}
+
+func (a *archiveFS) ReadLink(name string) (string, error) {
+	n, err := a.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !n.header.IsSymlink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return n.header.Linkname, nil
+}
+
+func (a *archiveFS) insert(h *Header, offset int64) {
+	name := CleanName(h.Filename)
+	if name == "." {
+		if h.IsDir() {
+			a.root.header = *h
+			a.root.header.Filename = name
+		}
+		return
+	}
+	var (
+		dir, base = path.Split(name)
+		parent    = a.mkdirAll(strings.TrimSuffix(dir, "/"), h)
+		curr      = parent.nodes[base]
+	)
+	if curr == nil {
+		curr = &fsNode{}
+		parent.nodes[base] = curr
+	}
+	curr.header = *h
+	curr.header.Filename = name
+	curr.offset = offset
+	if h.IsDir() && curr.nodes == nil {
+		curr.nodes = make(map[string]*fsNode)
+	}
+	if h.IsRegular() && h.Linkname != "" {
+		if n, err := a.lookup("link", CleanName(h.Linkname), false); err == nil && !n.header.IsDir() {
+			curr.offset = n.offset
+			curr.header.Size = n.header.Size
+		}
+	}
+}
+
+func (a *archiveFS) mkdirAll(dir string, h *Header) *fsNode {
+	curr := a.root
+	if dir == "" {
+		return curr
+	}
+	var name string
+	for _, base := range strings.Split(dir, "/") {
+		name = path.Join(name, base)
+		next := curr.nodes[base]
+		if next == nil || next.nodes == nil {
+			next = &fsNode{
+				header: Header{
+					Filename: name,
+					Mode:     ModeDir | 0755,
+					Uid:      h.Uid,
+					Gid:      h.Gid,
+					ModTime:  h.ModTime,
+				},
+				nodes: make(map[string]*fsNode),
+			}
+			curr.nodes[base] = next
+		}
+		curr = next
+	}
+	return curr
+}
+
+func (a *archiveFS) lookup(op, name string, follow bool) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n, err := a.resolve(name, follow, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return n, nil
+}
+
+func (a *archiveFS) resolve(name string, follow bool, depth int) (*fsNode, error) {
+	if depth > maxLinks {
+		return nil, errors.New("too many levels of symbolic links")
+	}
+	curr := a.root
+	if name == "." {
+		return curr, nil
+	}
+	parts := strings.Split(name, "/")
+	for i, base := range parts {
+		if curr.nodes == nil {
+			return nil, fs.ErrNotExist
+		}
+		next, ok := curr.nodes[base]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		if next.header.IsSymlink() && (follow || i < len(parts)-1) {
+			target := next.header.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(next.header.Filename), target)
+			}
+			n, err := a.resolve(CleanName(target), true, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			next = n
+		}
+		curr = next
+	}
+	return curr, nil
+}
+
+// CleanName returns the canonical form of the name of an entry: a relative
+// slash separated path without "." or ".." elements. The root is returned as
+// ".".
+func CleanName(name string) string {
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+type archiveFile struct {
+	*io.SectionReader
+	node *fsNode
+	name string
+	read int
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return fileInfo{node: f.node}, nil
+}
+
+func (f *archiveFile) Read(b []byte) (int, error) {
+	if f.SectionReader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.SectionReader.Read(b)
+}
+
+func (f *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	if f.SectionReader == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.SectionReader.Seek(offset, whence)
+}
+
+func (f *archiveFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.SectionReader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.SectionReader.ReadAt(b, off)
+}
+
+func (f *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.node.header.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrInvalid}
+	}
+	names := f.node.names()[f.read:]
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(names) {
+		names = names[:n]
+	}
+	f.read += len(names)
+	return readDir(f.node, names), nil
+}
+
+func (f *archiveFile) Close() error {
+	return nil
+}
+
+func readDir(n *fsNode, names []string) []fs.DirEntry {
+	es := make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		es = append(es, fileInfo{node: n.nodes[name]})
+	}
+	return es
+}
+
+type fileInfo struct {
+	node *fsNode
+}
+
+func (f fileInfo) Name() string {
+	return path.Base(f.node.header.Filename)
+}
+
+func (f fileInfo) Size() int64 {
+	if f.node.header.IsDir() {
+		return 0
+	}
+	return f.node.header.Size
+}
+
+func (f fileInfo) Mode() fs.FileMode {
+	return f.node.header.FileMode()
+}
+
+func (f fileInfo) Type() fs.FileMode {
+	return f.Mode().Type()
+}
+
+func (f fileInfo) ModTime() time.Time {
+	return f.node.header.ModTime
+}
+
+func (f fileInfo) IsDir() bool {
+	return f.node.header.IsDir()
+}
+
+func (f fileInfo) Sys() interface{} {
+	h := f.node.header
+	return &h
+}
+
+func (f fileInfo) Info() (fs.FileInfo, error) {
+	return f, nil
+}
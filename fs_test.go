@@ -0,0 +1,69 @@
+package tape_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/tar"
+)
+
+func TestFS(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		now  = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		w    = tar.NewTapeWriter(&buf)
+		list = []struct {
+			header  tape.Header
+			content string
+		}{
+			{header: tape.Header{Filename: "dir", Mode: tape.ModeDir | 0755}},
+			{header: tape.Header{Filename: "dir/a.txt", Mode: tape.ModeRegular | 0644}, content: "hello world\n"},
+			{header: tape.Header{Filename: "dir/sub/c.txt", Mode: tape.ModeRegular | 0600}, content: "nested\n"},
+			{header: tape.Header{Filename: "b.txt", Mode: tape.ModeRegular | 0644}, content: "top level file\n"},
+			{header: tape.Header{Filename: "empty", Mode: tape.ModeRegular | 0644}},
+		}
+	)
+	for _, e := range list {
+		h := e.header
+		h.ModTime = now
+		h.Size = int64(len(e.content))
+		if err := w.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if e.content == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := tape.FS(bytes.NewReader(buf.Bytes()), tar.Open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "b.txt", "empty", "dir/a.txt", "dir/sub/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(0, io.SeekStart); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("seek on directory: want %v, got %v", fs.ErrInvalid, err)
+	}
+	if _, err := f.(io.ReaderAt).ReadAt(make([]byte, 1), 0); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("readat on directory: want %v, got %v", fs.ErrInvalid, err)
+	}
+}
@@ -5,4 +5,7 @@ go 1.17
 require (
 	github.com/midbel/cli v0.2.1
 	github.com/midbel/rw v0.1.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.14.0
+	golang.org/x/sys v0.13.0
 )
@@ -0,0 +1,179 @@
+package tape
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+)
+
+var indexMagic = []byte("TIDX")
+
+const indexVersion = 1
+
+// maxIndexName bounds the length of the names read from an index so that a
+// corrupted file can not make ReadIndex allocate unbounded memory.
+const maxIndexName = 64 << 10
+
+type OpenFunc func(io.Reader) (Reader, error)
+
+// Offsetter is implemented by the readers that can report the positions of
+// the header and of the data of their current entry in the underlying stream.
+type Offsetter interface {
+	Offset() (int64, int64)
+}
+
+type IndexEntry struct {
+	Name   string
+	Header int64
+	Offset int64
+	Size   int64
+}
+
+// Index records the positions of the entries of an archive so that their
+// content can be accessed directly without scanning the whole archive again.
+type Index struct {
+	entries []IndexEntry
+	names   map[string]int
+	source  io.ReaderAt
+}
+
+// NewIndex scans the archive available in r with the reader returned by open
+// and records the positions of all its entries. The reader must implement
+// Offsetter.
+func NewIndex(r io.ReaderAt, open OpenFunc) (*Index, error) {
+	rs, err := open(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	off, ok := rs.(Offsetter)
+	if !ok {
+		return nil, fmt.Errorf("%w: reader can not report offsets", ErrUnsupported)
+	}
+	idx := Index{
+		names:  make(map[string]int),
+		source: r,
+	}
+	for {
+		h, err := rs.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		var (
+			hdr, data = off.Offset()
+			e         = IndexEntry{
+				Name:   h.Filename,
+				Header: hdr,
+				Offset: data,
+				Size:   h.Size,
+			}
+		)
+		idx.append(e)
+	}
+	return &idx, nil
+}
+
+// ReadIndex loads an index previously saved with WriteTo. The entries are
+// read from src.
+func ReadIndex(r io.Reader, src io.ReaderAt) (*Index, error) {
+	var (
+		rs    = bufio.NewReader(r)
+		magic = make([]byte, len(indexMagic)+1)
+	)
+	if _, err := io.ReadFull(rs, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic[:len(indexMagic)], indexMagic) {
+		return nil, ErrMagic
+	}
+	if v := magic[len(indexMagic)]; v != indexVersion {
+		return nil, fmt.Errorf("%w: index version %d", ErrUnsupported, v)
+	}
+	count, err := binary.ReadUvarint(rs)
+	if err != nil {
+		return nil, err
+	}
+	idx := Index{
+		names:  make(map[string]int),
+		source: src,
+	}
+	for i := uint64(0); i < count; i++ {
+		var e IndexEntry
+		z, err := binary.ReadUvarint(rs)
+		if err != nil {
+			return nil, err
+		}
+		if z > maxIndexName {
+			return nil, fmt.Errorf("%w: index name too long (%d bytes)", ErrHeader, z)
+		}
+		name := make([]byte, z)
+		if _, err := io.ReadFull(rs, name); err != nil {
+			return nil, err
+		}
+		e.Name = string(name)
+		for _, v := range []*int64{&e.Header, &e.Offset, &e.Size} {
+			if *v, err = binary.ReadVarint(rs); err != nil {
+				return nil, err
+			}
+		}
+		idx.append(e)
+	}
+	return &idx, nil
+}
+
+// WriteTo saves the index to w so that it can be stored in a sidecar file
+// next to the archive.
+func (i *Index) WriteTo(w io.Writer) (int64, error) {
+	var (
+		buf bytes.Buffer
+		tmp = make([]byte, binary.MaxVarintLen64)
+	)
+	buf.Write(indexMagic)
+	buf.WriteByte(indexVersion)
+	buf.Write(tmp[:binary.PutUvarint(tmp, uint64(len(i.entries)))])
+	for _, e := range i.entries {
+		buf.Write(tmp[:binary.PutUvarint(tmp, uint64(len(e.Name)))])
+		buf.WriteString(e.Name)
+		for _, v := range []int64{e.Header, e.Offset, e.Size} {
+			buf.Write(tmp[:binary.PutVarint(tmp, v)])
+		}
+	}
+	return io.Copy(w, &buf)
+}
+
+func (i *Index) Entries() []IndexEntry {
+	es := make([]IndexEntry, len(i.entries))
+	copy(es, i.entries)
+	return es
+}
+
+func (i *Index) Lookup(name string) (IndexEntry, bool) {
+	x, ok := i.names[name]
+	if !ok {
+		return IndexEntry{}, ok
+	}
+	return i.entries[x], ok
+}
+
+// Open returns a reader over the content of the named entry. If the archive
+// has more than one entry with the same name, the last one is returned.
+func (i *Index) Open(name string) (io.ReadCloser, error) {
+	e, ok := i.Lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	r := io.NewSectionReader(i.source, e.Offset, e.Size)
+	return io.NopCloser(r), nil
+}
+
+func (i *Index) append(e IndexEntry) {
+	i.names[e.Name] = len(i.entries)
+	i.entries = append(i.entries, e)
+}
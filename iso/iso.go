@@ -0,0 +1,901 @@
+package iso
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midbel/tape"
+)
+
+const (
+	sectorSize  = 2048
+	systemArea  = 16
+	maxRecord   = 254
+	recordLen   = 33
+	ceLen       = 28
+	volumeIdLen = 32
+)
+
+const (
+	flagDir = 0x02
+)
+
+const (
+	rripId     = "RRIP_1991A"
+	rripDesc   = "THE ROCK RIDGE INTERCHANGE PROTOCOL PROVIDES SUPPORT FOR POSIX FILE SYSTEM SEMANTICS"
+	rripSource = "PLEASE CONTACT DISC PUBLISHER FOR SPECIFICATION SOURCE"
+)
+
+var (
+	ErrTooLong  = errors.New("iso: system use area too long")
+	ErrTooLarge = errors.New("iso: file larger than 4GiB")
+)
+
+type node struct {
+	name   string
+	ident  string
+	header tape.Header
+	link   string
+	parent *node
+	nodes  []*node
+	// target is the file whose extent is shared by a hard link and shared
+	// counts the hard links to the node.
+	target *node
+	shared int
+
+	offset int64
+	extent uint32
+	length uint32
+
+	number  int
+	records []*record
+}
+
+func (n *node) isDir() bool {
+	return n.header.IsDir()
+}
+
+func (n *node) lookup(name string) *node {
+	for _, c := range n.nodes {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *node) links() int64 {
+	if n.target != nil {
+		return n.target.links()
+	}
+	if !n.isDir() {
+		return int64(1 + n.shared)
+	}
+	links := int64(2)
+	for _, c := range n.nodes {
+		if c.isDir() {
+			links++
+		}
+	}
+	return links
+}
+
+type record struct {
+	ident []byte
+	node  *node
+	su    []byte
+	more  []byte
+
+	block  uint32
+	offset uint32
+}
+
+func (r *record) Len() int {
+	n := recordLen + len(r.ident)
+	if len(r.ident)%2 == 0 {
+		n++
+	}
+	n += len(r.su)
+	if len(r.more) > 0 {
+		n += ceLen
+	}
+	if n%2 == 1 {
+		n++
+	}
+	return n
+}
+
+// Writer builds an ISO 9660 image with Rock Ridge extensions. Since the
+// volume descriptors and the directory hierarchy can only be computed once
+// every entries are known, the content of the files is spooled into a
+// temporary file and the image is written to the underlying writer when the
+// Writer is closed.
+type Writer struct {
+	inner io.Writer
+	curr  io.Writer
+	err   error
+
+	label string
+	root  *node
+	node  *node
+	link  bytes.Buffer
+	spool *os.File
+	pos   int64
+	now   time.Time
+
+	size    int
+	written int
+}
+
+func NewWriter(w io.Writer, label string) *Writer {
+	var (
+		now  = time.Now()
+		root = node{
+			header: tape.Header{
+				Mode:    tape.ModeDir | 0755,
+				ModTime: now,
+			},
+		}
+	)
+	return &Writer{
+		inner: w,
+		label: label,
+		root:  &root,
+		now:   now,
+	}
+}
+
+// SetTime sets the creation time of the volume and the modification time of
+// its root directory.
+func (w *Writer) SetTime(t time.Time) {
+	w.now = t
+	w.root.header.ModTime = t
+}
+
+func (w *Writer) WriteHeader(h *tape.Header) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.err = w.Flush(); w.err != nil {
+		return w.err
+	}
+	name := strings.Trim(path.Clean("/"+h.Filename), "/")
+	if name == "" {
+		w.root.header = *h
+		w.root.header.Mode = tape.ModeDir | h.Perm()
+		return nil
+	}
+	var (
+		dir, base = path.Split(name)
+		parent    = w.mkdirAll(strings.Trim(dir, "/"), h)
+		curr      = parent.lookup(base)
+	)
+	if curr == nil {
+		curr = &node{
+			name:   base,
+			parent: parent,
+		}
+		parent.nodes = append(parent.nodes, curr)
+	}
+	curr.header = *h
+	curr.link = h.Linkname
+	curr.length = 0
+	curr.target = nil
+	switch {
+	case h.IsDir():
+	case h.IsSymlink():
+		w.link.Reset()
+		w.curr = tape.LimitWriter(&w.link, h.Size)
+	case h.IsRegular():
+		if curr.nodes != nil {
+			w.err = fmt.Errorf("iso: %s: directory replaced by file", h.Filename)
+			return w.err
+		}
+		curr.header.Mode = tape.ModeRegular | h.Perm()
+		if h.Linkname != "" && h.Size == 0 {
+			w.err = w.linkTo(curr, h.Linkname)
+			break
+		}
+		if w.err = w.openSpool(); w.err != nil {
+			return w.err
+		}
+		if h.Size > math.MaxUint32 {
+			w.err = fmt.Errorf("%w: %s", ErrTooLarge, h.Filename)
+			return w.err
+		}
+		curr.offset = w.pos
+		curr.length = uint32(h.Size)
+		w.curr = tape.LimitWriter(w.spool, h.Size)
+	}
+	w.node = curr
+	if w.curr != nil {
+		w.size = int(h.Size)
+	}
+	return w.err
+}
+
+// linkTo makes n a hard link to the file named target: both nodes share the
+// same extent.
+func (w *Writer) linkTo(n *node, target string) error {
+	curr := w.root
+	for _, name := range strings.Split(strings.Trim(path.Clean("/"+target), "/"), "/") {
+		if curr = curr.lookup(name); curr == nil {
+			break
+		}
+	}
+	if curr == nil || !curr.header.IsRegular() {
+		return fmt.Errorf("iso: %s: hard link target %s not found", n.header.Filename, target)
+	}
+	if curr.target != nil {
+		curr = curr.target
+	}
+	if curr == n {
+		return fmt.Errorf("iso: %s: hard link to itself", n.header.Filename)
+	}
+	n.target = curr
+	curr.shared++
+	return nil
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.curr == nil {
+		return 0, tape.ErrTooLong
+	}
+	n, err := w.curr.Write(b)
+	w.written += n
+	w.err = err
+	return n, err
+}
+
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.node == nil {
+		return nil
+	}
+	if w.curr != nil && w.written < w.size {
+		return tape.ErrTooShort
+	}
+	if w.node.header.IsSymlink() && w.link.Len() > 0 {
+		w.node.link = w.link.String()
+	} else if w.node.header.IsRegular() {
+		w.pos += int64(w.written)
+	}
+	w.reset()
+	return nil
+}
+
+func (w *Writer) Close() error {
+	if w.spool != nil {
+		defer func() {
+			w.spool.Close()
+			os.Remove(w.spool.Name())
+		}()
+	}
+	if w.err = w.Flush(); w.err != nil {
+		return w.err
+	}
+	var (
+		dirs  = w.prepare()
+		table = pathTableSize(dirs)
+		next  = uint32(systemArea + 2)
+	)
+	locL := next
+	next += sectors(table)
+	locM := next
+	next += sectors(table)
+	for _, d := range dirs {
+		d.extent = next
+		d.length = directorySize(d.records)
+		next += sectors(d.length)
+	}
+	cont, next, err := layoutContinuation(dirs, next)
+	if err != nil {
+		w.err = err
+		return w.err
+	}
+	for _, d := range dirs {
+		for _, n := range d.nodes {
+			if n.isDir() || n.target != nil || n.length == 0 {
+				continue
+			}
+			n.extent = next
+			next += sectors(n.length)
+		}
+	}
+	for _, d := range dirs {
+		for _, n := range d.nodes {
+			if n.target != nil {
+				n.extent, n.length = n.target.extent, n.target.length
+			}
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, sectorSize*(systemArea+2)))
+	buf.Write(make([]byte, sectorSize*systemArea))
+	buf.Write(w.primaryDescriptor(next, table, locL, locM))
+	buf.Write(terminatorDescriptor())
+	if _, w.err = io.Copy(w.inner, buf); w.err != nil {
+		return w.err
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if w.err = w.writeSector(writePathTable(dirs, order)); w.err != nil {
+			return w.err
+		}
+	}
+	for _, d := range dirs {
+		if w.err = w.writeSector(writeDirectory(d)); w.err != nil {
+			return w.err
+		}
+	}
+	if w.err = w.writeSector(cont); w.err != nil {
+		return w.err
+	}
+	for _, d := range dirs {
+		for _, n := range d.nodes {
+			if n.isDir() || n.target != nil || n.length == 0 {
+				continue
+			}
+			if w.err = w.copyFile(n); w.err != nil {
+				return w.err
+			}
+		}
+	}
+	return w.err
+}
+
+func (w *Writer) reset() {
+	w.size = 0
+	w.written = 0
+	w.curr = nil
+	w.node = nil
+}
+
+func (w *Writer) openSpool() error {
+	if w.spool != nil {
+		return nil
+	}
+	f, err := os.CreateTemp("", "iso-*")
+	if err == nil {
+		w.spool = f
+	}
+	return err
+}
+
+func (w *Writer) mkdirAll(dir string, h *tape.Header) *node {
+	curr := w.root
+	if dir == "" {
+		return curr
+	}
+	for _, name := range strings.Split(dir, "/") {
+		next := curr.lookup(name)
+		if next == nil {
+			next = &node{
+				name:   name,
+				parent: curr,
+				header: tape.Header{
+					Mode:    tape.ModeDir | 0755,
+					Uid:     h.Uid,
+					Gid:     h.Gid,
+					ModTime: h.ModTime,
+				},
+			}
+			curr.nodes = append(curr.nodes, next)
+		}
+		curr = next
+	}
+	return curr
+}
+
+func (w *Writer) writeSector(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if mod := len(b) % sectorSize; mod > 0 {
+		b = append(b, make([]byte, sectorSize-mod)...)
+	}
+	_, err := w.inner.Write(b)
+	return err
+}
+
+func (w *Writer) copyFile(n *node) error {
+	r := io.NewSectionReader(w.spool, n.offset, int64(n.length))
+	if _, err := io.Copy(w.inner, r); err != nil {
+		return err
+	}
+	if mod := n.length % sectorSize; mod > 0 {
+		_, err := w.inner.Write(make([]byte, sectorSize-mod))
+		return err
+	}
+	return nil
+}
+
+// prepare assigns the ISO identifiers of each node and computes the
+// directory records of each directories. The directories are returned in the
+// order expected by the path table.
+func (w *Writer) prepare() []*node {
+	var (
+		dirs  []*node
+		queue = []*node{w.root}
+	)
+	w.root.parent = w.root
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+
+		d.number = len(dirs) + 1
+		dirs = append(dirs, d)
+
+		assignIdents(d.nodes)
+		for _, n := range d.nodes {
+			if n.isDir() {
+				queue = append(queue, n)
+			}
+		}
+	}
+	for _, d := range dirs {
+		self := record{
+			ident: []byte{0},
+			node:  d,
+			su:    rockRidge(d, "", d == w.root),
+		}
+		parent := record{
+			ident: []byte{1},
+			node:  d.parent,
+			su:    rockRidge(d.parent, "", false),
+		}
+		d.records = append(d.records, &self, &parent)
+		for _, n := range d.nodes {
+			r := record{
+				ident: []byte(n.ident),
+				node:  n,
+				su:    rockRidge(n, n.name, false),
+			}
+			d.records = append(d.records, &r)
+		}
+		for _, r := range d.records {
+			r.split()
+		}
+	}
+	return dirs
+}
+
+func (r *record) split() {
+	var (
+		base  = recordLen + len(r.ident) + (len(r.ident)+1)%2
+		avail = maxRecord - base
+	)
+	if len(r.su) <= avail {
+		return
+	}
+	avail -= ceLen
+	var n int
+	for n < len(r.su) {
+		z := int(r.su[n+2])
+		if n+z > avail {
+			break
+		}
+		n += z
+	}
+	r.more = r.su[n:]
+	r.su = r.su[:n]
+}
+
+func (w *Writer) primaryDescriptor(total, table, locL, locM uint32) []byte {
+	var (
+		buf = make([]byte, sectorSize)
+		now = dateTime(w.now)
+	)
+	buf[0] = 1
+	copy(buf[1:], "CD001")
+	buf[6] = 1
+	copy(buf[8:40], padString("", 32))
+	copy(buf[40:72], padString(w.label, volumeIdLen))
+	putBoth32(buf[80:], total)
+	putBoth16(buf[120:], 1)
+	putBoth16(buf[124:], 1)
+	putBoth16(buf[128:], sectorSize)
+	putBoth32(buf[132:], table)
+	binary.LittleEndian.PutUint32(buf[140:], locL)
+	binary.BigEndian.PutUint32(buf[148:], locM)
+
+	root := record{
+		ident: []byte{0},
+		node:  w.root,
+	}
+	root.encode(buf[156:156+34], false)
+
+	for _, off := range []int{190, 318, 446, 574} {
+		copy(buf[off:off+128], padString("", 128))
+	}
+	for _, off := range []int{702, 739, 776} {
+		copy(buf[off:off+37], padString("", 37))
+	}
+	copy(buf[813:], now)
+	copy(buf[830:], now)
+	copy(buf[847:], dateTime(time.Time{}))
+	copy(buf[864:], dateTime(time.Time{}))
+	buf[881] = 1
+	return buf
+}
+
+func terminatorDescriptor() []byte {
+	buf := make([]byte, sectorSize)
+	buf[0] = 255
+	copy(buf[1:], "CD001")
+	buf[6] = 1
+	return buf
+}
+
+func (r *record) encode(buf []byte, rr bool) int {
+	var (
+		size = recordLen + len(r.ident) + (len(r.ident)+1)%2
+		n    = r.node
+	)
+	if rr {
+		size = r.Len()
+	}
+	buf[0] = byte(size)
+	putBoth32(buf[2:], n.extent)
+	putBoth32(buf[10:], n.length)
+	copy(buf[18:], recordTime(n.header.ModTime))
+	if n.isDir() {
+		buf[25] = flagDir
+	}
+	putBoth16(buf[28:], 1)
+	buf[32] = byte(len(r.ident))
+	off := copy(buf[33:], r.ident) + 33
+	off += (len(r.ident) + 1) % 2
+	if !rr {
+		return size
+	}
+	off += copy(buf[off:], r.su)
+	if len(r.more) > 0 {
+		ce := suspEntry("CE", 1, make([]byte, ceLen-4))
+		putBoth32(ce[4:], r.block)
+		putBoth32(ce[12:], r.offset)
+		putBoth32(ce[20:], uint32(len(r.more)))
+		copy(buf[off:], ce)
+	}
+	return size
+}
+
+func writeDirectory(d *node) []byte {
+	var (
+		buf = make([]byte, d.length)
+		off int
+	)
+	for _, r := range d.records {
+		z := r.Len()
+		if rest := sectorSize - off%sectorSize; z > rest {
+			off += rest
+		}
+		r.encode(buf[off:], true)
+		off += z
+	}
+	return buf
+}
+
+func directorySize(records []*record) uint32 {
+	var off int
+	for _, r := range records {
+		z := r.Len()
+		if rest := sectorSize - off%sectorSize; z > rest {
+			off += rest
+		}
+		off += z
+	}
+	return sectors(uint32(off)) * sectorSize
+}
+
+func layoutContinuation(dirs []*node, block uint32) ([]byte, uint32, error) {
+	var buf []byte
+	for _, d := range dirs {
+		for _, r := range d.records {
+			if len(r.more) == 0 {
+				continue
+			}
+			if len(r.more) > sectorSize {
+				return nil, 0, fmt.Errorf("%w: %s", ErrTooLong, r.node.name)
+			}
+			if rest := sectorSize - len(buf)%sectorSize; len(r.more) > rest {
+				buf = append(buf, make([]byte, rest)...)
+			}
+			r.block = block + uint32(len(buf)/sectorSize)
+			r.offset = uint32(len(buf) % sectorSize)
+			buf = append(buf, r.more...)
+		}
+	}
+	return buf, block + sectors(uint32(len(buf))), nil
+}
+
+func pathTableSize(dirs []*node) uint32 {
+	var size uint32
+	for _, d := range dirs {
+		size += uint32(pathRecordLen(d))
+	}
+	return size
+}
+
+func pathRecordLen(d *node) int {
+	z := len(d.ident)
+	if z == 0 {
+		z = 1
+	}
+	return 8 + z + z%2
+}
+
+func writePathTable(dirs []*node, order binary.ByteOrder) []byte {
+	var buf []byte
+	for _, d := range dirs {
+		var (
+			rec   = make([]byte, pathRecordLen(d))
+			ident = []byte(d.ident)
+		)
+		if len(ident) == 0 {
+			ident = []byte{0}
+		}
+		rec[0] = byte(len(ident))
+		order.PutUint32(rec[2:], d.extent)
+		order.PutUint16(rec[6:], uint16(d.parent.number))
+		copy(rec[8:], ident)
+		buf = append(buf, rec...)
+	}
+	return buf
+}
+
+// rockRidge returns the system use entries of the record of n. No NM entry is
+// written when name is empty, as for the records of the current and the parent
+// directories.
+func rockRidge(n *node, name string, root bool) []byte {
+	var (
+		buf bytes.Buffer
+		h   = n.header
+	)
+	if root {
+		buf.Write(suspEntry("SP", 1, []byte{0xBE, 0xEF, 0}))
+	}
+	px := make([]byte, 32)
+	putBoth32(px[0:], uint32(h.Mode))
+	putBoth32(px[8:], uint32(n.links()))
+	putBoth32(px[16:], uint32(h.Uid))
+	putBoth32(px[24:], uint32(h.Gid))
+	buf.Write(suspEntry("PX", 1, px))
+
+	var (
+		when = recordTime(h.ModTime)
+		tf   = []byte{0x0E}
+	)
+	for i := 0; i < 3; i++ {
+		tf = append(tf, when...)
+	}
+	buf.Write(suspEntry("TF", 1, tf))
+
+	if h.IsDevice() {
+		pn := make([]byte, 16)
+		putBoth32(pn[0:], uint32(h.RMajor))
+		putBoth32(pn[8:], uint32(h.RMinor))
+		buf.Write(suspEntry("PN", 1, pn))
+	}
+	if name != "" {
+		writeName(&buf, name)
+	}
+	if h.IsSymlink() {
+		writeLink(&buf, n.link)
+	}
+	if root {
+		er := []byte{byte(len(rripId)), byte(len(rripDesc)), byte(len(rripSource)), 1}
+		er = append(er, rripId...)
+		er = append(er, rripDesc...)
+		er = append(er, rripSource...)
+		buf.Write(suspEntry("ER", 1, er))
+	}
+	return buf.Bytes()
+}
+
+func writeName(buf *bytes.Buffer, name string) {
+	const max = 250
+	for len(name) > max {
+		buf.Write(suspEntry("NM", 1, append([]byte{0x01}, name[:max]...)))
+		name = name[max:]
+	}
+	buf.Write(suspEntry("NM", 1, append([]byte{0}, name...)))
+}
+
+func writeLink(buf *bytes.Buffer, link string) {
+	const max = 248
+	var comps [][]byte
+	if strings.HasPrefix(link, "/") {
+		comps = append(comps, []byte{0x08, 0})
+	}
+	for _, c := range strings.Split(strings.Trim(link, "/"), "/") {
+		switch c {
+		case "":
+			continue
+		case ".":
+			comps = append(comps, []byte{0x02, 0})
+			continue
+		case "..":
+			comps = append(comps, []byte{0x04, 0})
+			continue
+		}
+		for len(c) > max {
+			comps = append(comps, append([]byte{0x01, max}, c[:max]...))
+			c = c[max:]
+		}
+		comps = append(comps, append([]byte{0, byte(len(c))}, c...))
+	}
+	var sl []byte
+	for i, c := range comps {
+		if len(sl)+len(c) > max {
+			buf.Write(suspEntry("SL", 1, append([]byte{0x01}, sl...)))
+			sl = sl[:0]
+		}
+		sl = append(sl, c...)
+		if i == len(comps)-1 {
+			buf.Write(suspEntry("SL", 1, append([]byte{0}, sl...)))
+		}
+	}
+}
+
+func suspEntry(sig string, version byte, data []byte) []byte {
+	buf := make([]byte, 4, 4+len(data))
+	copy(buf, sig)
+	buf[2] = byte(4 + len(data))
+	buf[3] = version
+	return append(buf, data...)
+}
+
+func assignIdents(nodes []*node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+	seen := make(map[string]struct{})
+	for _, n := range nodes {
+		base, ext := splitName(n)
+		for i := 1; ; i++ {
+			id := base
+			if ext != "" || !n.isDir() {
+				id += "." + ext
+			}
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				n.ident = id
+				break
+			}
+			suffix := "_" + strconv.Itoa(i)
+			if len(base)+len(suffix) > 8 {
+				base = base[:8-len(suffix)]
+			}
+			base = strings.TrimRight(base, "_0123456789")
+			if base == "" {
+				base = "_"
+			}
+			base += suffix
+		}
+		if !n.isDir() {
+			n.ident += ";1"
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return compareIdents(nodes[i].ident, nodes[j].ident)
+	})
+}
+
+func splitName(n *node) (string, string) {
+	var (
+		base = n.name
+		ext  string
+	)
+	if !n.isDir() {
+		if x := strings.LastIndexByte(base, '.'); x > 0 {
+			base, ext = base[:x], base[x+1:]
+		}
+	}
+	base = sanitize(base, 8)
+	if base == "" {
+		base = "_"
+	}
+	return base, sanitize(ext, 3)
+}
+
+func sanitize(str string, max int) string {
+	var buf strings.Builder
+	for _, c := range strings.ToUpper(str) {
+		if buf.Len() >= max {
+			break
+		}
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			buf.WriteRune(c)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	return buf.String()
+}
+
+func compareIdents(a, b string) bool {
+	split := func(str string) (string, string) {
+		str, _, _ = strings.Cut(str, ";")
+		base, ext, _ := strings.Cut(str, ".")
+		return base, ext
+	}
+	pad := func(a, b string) (string, string) {
+		for len(a) < len(b) {
+			a += " "
+		}
+		for len(b) < len(a) {
+			b += " "
+		}
+		return a, b
+	}
+	var (
+		ab, ae = split(a)
+		bb, be = split(b)
+	)
+	ab, bb = pad(ab, bb)
+	if ab != bb {
+		return ab < bb
+	}
+	ae, be = pad(ae, be)
+	return ae < be
+}
+
+func sectors(n uint32) uint32 {
+	return (n + sectorSize - 1) / sectorSize
+}
+
+func putBoth16(buf []byte, v uint16) {
+	binary.LittleEndian.PutUint16(buf, v)
+	binary.BigEndian.PutUint16(buf[2:], v)
+}
+
+func putBoth32(buf []byte, v uint32) {
+	binary.LittleEndian.PutUint32(buf, v)
+	binary.BigEndian.PutUint32(buf[4:], v)
+}
+
+func padString(str string, n int) string {
+	if len(str) > n {
+		return str[:n]
+	}
+	return str + strings.Repeat(" ", n-len(str))
+}
+
+func recordTime(t time.Time) []byte {
+	if t.IsZero() {
+		return make([]byte, 7)
+	}
+	t = t.UTC()
+	return []byte{
+		byte(t.Year() - 1900),
+		byte(t.Month()),
+		byte(t.Day()),
+		byte(t.Hour()),
+		byte(t.Minute()),
+		byte(t.Second()),
+		0,
+	}
+}
+
+func dateTime(t time.Time) []byte {
+	if t.IsZero() {
+		return append([]byte(strings.Repeat("0", 16)), 0)
+	}
+	str := t.UTC().Format("20060102150405") + "00"
+	return append([]byte(str), 0)
+}
@@ -0,0 +1,223 @@
+package iso
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midbel/tape"
+)
+
+type testEntry struct {
+	Header  tape.Header
+	Content string
+}
+
+func TestRoundTrip(t *testing.T) {
+	var (
+		now  = time.Date(2021, 6, 1, 12, 30, 15, 0, time.UTC)
+		long = strings.Repeat("long-name-", 30)
+		big  = strings.Repeat("0123456789abcdef", 300)
+	)
+	data := []testEntry{
+		{Header: tape.Header{Filename: "dir", Mode: tape.ModeDir | 0750, Uid: 1000, Gid: 100}},
+		{Header: tape.Header{Filename: "dir/a.txt", Mode: tape.ModeRegular | 0644, Uid: 1000, Gid: 100}, Content: "hello world\n"},
+		{Header: tape.Header{Filename: "dir/big.bin", Mode: tape.ModeRegular | 0600}, Content: big},
+		{Header: tape.Header{Filename: "dir/hard", Mode: tape.ModeRegular | 0644, Linkname: "dir/a.txt"}},
+		{Header: tape.Header{Filename: "dir/link", Mode: tape.ModeSymlink | 0777, Linkname: "../top/" + long}},
+		{Header: tape.Header{Filename: "empty", Mode: tape.ModeRegular | 0644}},
+		{Header: tape.Header{Filename: "top/" + long, Mode: tape.ModeRegular | 0640}, Content: "long\n"},
+	}
+	image := writeImage(t, now, data)
+
+	want := map[string]testEntry{
+		"top": {Header: tape.Header{Mode: tape.ModeDir | 0755}},
+	}
+	for _, e := range data {
+		if e.Header.Linkname != "" && e.Header.IsRegular() {
+			target := want[e.Header.Linkname]
+			e.Content = target.Content
+			e.Header.Linkname = ""
+		}
+		want[e.Header.Filename] = e
+	}
+	r, err := NewReader(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, ok := want[h.Filename]
+		if !ok {
+			t.Errorf("%s: unexpected entry", h.Filename)
+			continue
+		}
+		delete(want, h.Filename)
+
+		if h.IsRegular() {
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s: %s", h.Filename, err)
+			}
+			if string(content) != e.Content {
+				t.Errorf("%s: content mismatch", h.Filename)
+			}
+		}
+		if h.Mode != e.Header.Mode {
+			t.Errorf("%s: want mode %o, got %o", h.Filename, e.Header.Mode, h.Mode)
+		}
+		if h.Uid != e.Header.Uid || h.Gid != e.Header.Gid {
+			t.Errorf("%s: want owner %d:%d, got %d:%d", h.Filename, e.Header.Uid, e.Header.Gid, h.Uid, h.Gid)
+		}
+		if h.IsSymlink() && h.Linkname != e.Header.Linkname {
+			t.Errorf("%s: want link %s, got %s", h.Filename, e.Header.Linkname, h.Linkname)
+		}
+		if h.IsRegular() && h.Size != int64(len(e.Content)) {
+			t.Errorf("%s: want size %d, got %d", h.Filename, len(e.Content), h.Size)
+		}
+		if !h.ModTime.Equal(now) {
+			t.Errorf("%s: want mtime %s, got %s", h.Filename, now, h.ModTime)
+		}
+	}
+	for n := range want {
+		t.Errorf("%s: entry not found", n)
+	}
+}
+
+func TestHardLinks(t *testing.T) {
+	image := writeImage(t, time.Now(), []testEntry{
+		{Header: tape.Header{Filename: "a", Mode: tape.ModeRegular | 0644}, Content: "shared"},
+		{Header: tape.Header{Filename: "b", Mode: tape.ModeRegular | 0644, Linkname: "a"}},
+		{Header: tape.Header{Filename: "c", Mode: tape.ModeRegular | 0644, Linkname: "b"}},
+	})
+	records := readRecords(t, image, rootExtent(image))
+	if len(records) != 5 {
+		t.Fatalf("want 5 records, got %d", len(records))
+	}
+	extent := binary.LittleEndian.Uint32(records[2][2:])
+	for _, rec := range records[2:] {
+		if x := binary.LittleEndian.Uint32(rec[2:]); x != extent {
+			t.Errorf("want extent %d, got %d", extent, x)
+		}
+		if n := binary.LittleEndian.Uint32(systemUse(rec, "PX")[8:]); n != 3 {
+			t.Errorf("want 3 links, got %d", n)
+		}
+	}
+
+	for _, target := range []string{"missing", "dir"} {
+		w := NewWriter(io.Discard, "")
+		w.WriteHeader(&tape.Header{Filename: "dir", Mode: tape.ModeDir | 0755})
+		err := w.WriteHeader(&tape.Header{Filename: "x", Mode: tape.ModeRegular | 0644, Linkname: target})
+		if err == nil {
+			t.Errorf("%s: invalid hard link accepted", target)
+		}
+	}
+}
+
+func TestDotRecords(t *testing.T) {
+	image := writeImage(t, time.Now(), []testEntry{
+		{Header: tape.Header{Filename: "dir/file", Mode: tape.ModeRegular | 0644}, Content: "data"},
+	})
+	root := readRecords(t, image, rootExtent(image))
+	if len(root) != 3 {
+		t.Fatalf("want 3 records, got %d", len(root))
+	}
+	dir := readRecords(t, image, binary.LittleEndian.Uint32(root[2][2:]))
+	for _, rec := range [][]byte{root[0], root[1], dir[0], dir[1]} {
+		if systemUse(rec, "NM") != nil {
+			t.Errorf("NM entry in record %d", rec[33])
+		}
+		if systemUse(rec, "PX") == nil {
+			t.Errorf("no PX entry in record %d", rec[33])
+		}
+	}
+	if nm := systemUse(dir[2], "NM"); string(nm[1:]) != "file" {
+		t.Errorf("want name file, got %q", nm)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	w := NewWriter(io.Discard, "")
+	err := w.WriteHeader(&tape.Header{
+		Filename: "large",
+		Mode:     tape.ModeRegular | 0644,
+		Size:     math.MaxUint32 + 1,
+	})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("want %v, got %v", ErrTooLarge, err)
+	}
+	w.Close()
+}
+
+func writeImage(t *testing.T, when time.Time, data []testEntry) []byte {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		w   = NewWriter(&buf, "TEST")
+	)
+	w.SetTime(when)
+	for _, e := range data {
+		h := e.Header
+		h.ModTime = when
+		h.Size = int64(len(e.Content))
+		if err := w.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if e.Content == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, e.Content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rootExtent returns the extent of the root directory given in the primary
+// volume descriptor.
+func rootExtent(image []byte) uint32 {
+	return binary.LittleEndian.Uint32(image[systemArea*sectorSize+156+2:])
+}
+
+// readRecords returns the records of the first sector of the directory
+// stored at block.
+func readRecords(t *testing.T, image []byte, block uint32) [][]byte {
+	t.Helper()
+	var (
+		buf  = image[block*sectorSize : (block+1)*sectorSize]
+		list [][]byte
+	)
+	for len(buf) > 0 && buf[0] != 0 {
+		z := int(buf[0])
+		list = append(list, buf[:z])
+		buf = buf[z:]
+	}
+	return list
+}
+
+// systemUse returns the data of the system use entry sig of rec.
+func systemUse(rec []byte, sig string) []byte {
+	n := int(rec[32])
+	su := rec[recordLen+n+(n+1)%2:]
+	for len(su) >= 4 && int(su[2]) >= 4 && int(su[2]) <= len(su) {
+		if string(su[:2]) == sig {
+			return su[4:su[2]]
+		}
+		su = su[su[2]:]
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+package iso
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/midbel/tape"
+)
+
+const (
+	flagAssoc = 0x04
+	flagMulti = 0x80
+)
+
+var ErrFormat = errors.New("iso: invalid image")
+
+// maxExtent bounds the size of the directories and of the continuation areas
+// read in memory.
+const maxExtent = 16 << 20
+
+type extent struct {
+	block  uint32
+	length uint32
+}
+
+type entry struct {
+	name    string
+	extents []extent
+	flags   byte
+	header  tape.Header
+	skip    bool
+}
+
+type directory struct {
+	prefix  string
+	entries []*entry
+}
+
+// Reader walks the directory hierarchy of an ISO 9660 image and returns its
+// entries in depth first order. The names, the permissions, the owners and
+// the targets of the symbolic links are taken from the Rock Ridge extensions
+// when the image has them. The Joliet and the El Torito extensions are
+// ignored.
+type Reader struct {
+	inner io.ReaderAt
+	curr  io.Reader
+	err   error
+
+	rock  bool
+	skip  int
+	stack []*directory
+}
+
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	rs := Reader{
+		inner: r,
+	}
+	root, err := rs.readDescriptors()
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.detectRockRidge(root); err != nil {
+		return nil, err
+	}
+	if err := rs.pushDir("", root); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// Open returns a tape.Reader for the ISO image read from r. r should
+// implement io.ReaderAt.
+func Open(r io.Reader) (tape.Reader, error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, fmt.Errorf("iso: %w: not seekable", tape.ErrUnsupported)
+	}
+	return NewReader(ra)
+}
+
+// IsImage reports whether r holds an ISO 9660 image.
+func IsImage(r io.ReaderAt) bool {
+	magic := make([]byte, 5)
+	_, err := r.ReadAt(magic, systemArea*sectorSize+1)
+	return err == nil && string(magic) == "CD001"
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.curr == nil {
+		return 0, tape.ErrRead
+	}
+	n, err := r.curr.Read(b)
+	if errors.Is(err, io.EOF) {
+		r.curr = nil
+	} else if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *Reader) Next() (*tape.Header, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.curr = nil
+	for len(r.stack) > 0 {
+		d := r.stack[len(r.stack)-1]
+		if len(d.entries) == 0 {
+			r.stack = r.stack[:len(r.stack)-1]
+			continue
+		}
+		e := d.entries[0]
+		d.entries = d.entries[1:]
+
+		h := e.header
+		h.Filename = path.Join(d.prefix, e.name)
+		switch {
+		case h.IsDir():
+			r.err = r.pushDir(h.Filename, e)
+		case h.IsRegular():
+			rs := make([]io.Reader, 0, len(e.extents))
+			for _, x := range e.extents {
+				rs = append(rs, io.NewSectionReader(r.inner, int64(x.block)*sectorSize, int64(x.length)))
+			}
+			r.curr = io.MultiReader(rs...)
+		}
+		return &h, r.err
+	}
+	return nil, io.EOF
+}
+
+func (r *Reader) readDescriptors() (*entry, error) {
+	buf := make([]byte, sectorSize)
+	for i := int64(systemArea); ; i++ {
+		if _, err := r.inner.ReadAt(buf, i*sectorSize); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+		}
+		if string(buf[1:6]) != "CD001" {
+			return nil, fmt.Errorf("%w: missing volume descriptor", ErrFormat)
+		}
+		switch buf[0] {
+		case 1:
+			e, _, err := r.parseRecord(buf[156 : 156+34])
+			if err != nil {
+				return nil, err
+			}
+			return e, nil
+		case 255:
+			return nil, fmt.Errorf("%w: missing primary volume descriptor", ErrFormat)
+		}
+	}
+}
+
+// detectRockRidge looks for the SP entry in the first record of the root
+// directory telling that the image uses the System Use Sharing Protocol.
+func (r *Reader) detectRockRidge(root *entry) error {
+	buf := make([]byte, sectorSize)
+	if _, err := r.inner.ReadAt(buf, int64(root.extents[0].block)*sectorSize); err != nil {
+		return err
+	}
+	z := int(buf[0])
+	if z < recordLen+1 || z > len(buf) {
+		return fmt.Errorf("%w: invalid root directory", ErrFormat)
+	}
+	su := buf[recordLen+1 : z]
+	if len(su) >= 7 && string(su[:2]) == "SP" && su[4] == 0xBE && su[5] == 0xEF {
+		r.rock = true
+		r.skip = int(su[6])
+	}
+	return nil
+}
+
+func (r *Reader) pushDir(prefix string, e *entry) error {
+	d := directory{
+		prefix: prefix,
+	}
+	for _, x := range e.extents {
+		if x.length > maxExtent {
+			return fmt.Errorf("%w: %s: directory too large", ErrFormat, prefix)
+		}
+		buf := make([]byte, x.length)
+		if _, err := r.inner.ReadAt(buf, int64(x.block)*sectorSize); err != nil {
+			return err
+		}
+		for off := 0; off < len(buf); {
+			if buf[off] == 0 {
+				off += sectorSize - off%sectorSize
+				continue
+			}
+			e, z, err := r.parseRecord(buf[off:])
+			if err != nil {
+				return err
+			}
+			off += z
+			if e.skip {
+				continue
+			}
+			if n := len(d.entries); n > 0 && d.entries[n-1].flags&flagMulti != 0 {
+				prev := d.entries[n-1]
+				prev.extents = append(prev.extents, e.extents...)
+				prev.header.Size += e.header.Size
+				prev.flags = e.flags
+				continue
+			}
+			d.entries = append(d.entries, e)
+		}
+	}
+	r.stack = append(r.stack, &d)
+	return nil
+}
+
+// parseRecord parses the directory record at the start of buf. It returns
+// the entry described by the record and the length of the record.
+func (r *Reader) parseRecord(buf []byte) (*entry, int, error) {
+	z := int(buf[0])
+	if z < recordLen || z > len(buf) || recordLen+int(buf[32]) > z {
+		return nil, 0, fmt.Errorf("%w: invalid directory record", ErrFormat)
+	}
+	var (
+		size  = binary.LittleEndian.Uint32(buf[10:])
+		ident = string(buf[33 : 33+int(buf[32])])
+		e     = entry{
+			flags: buf[25],
+			extents: []extent{
+				{
+					block:  binary.LittleEndian.Uint32(buf[2:]),
+					length: size,
+				},
+			},
+		}
+	)
+	e.header = tape.Header{
+		Mode:    tape.ModeRegular | 0644,
+		Links:   1,
+		ModTime: parseRecordTime(buf[18:25]),
+	}
+	if e.flags&flagDir != 0 {
+		e.header.Mode = tape.ModeDir | 0755
+		e.header.Links = 2
+	} else {
+		e.header.Size = int64(size)
+	}
+	switch {
+	case ident == "\x00" || ident == "\x01" || e.flags&flagAssoc != 0:
+		e.skip = true
+	default:
+		e.name = isoName(ident, e.flags&flagDir != 0)
+	}
+	if r.rock && !e.skip {
+		off := recordLen + len(ident) + (len(ident)+1)%2 + r.skip
+		if off < z {
+			if err := r.parseSystemUse(&e, buf[off:z]); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return &e, z, nil
+}
+
+// parseSystemUse applies the Rock Ridge entries found in the system use area
+// of a record to e.
+func (r *Reader) parseSystemUse(e *entry, su []byte) error {
+	var (
+		name  strings.Builder
+		link  strings.Builder
+		named bool
+		cont  bool
+		areas int
+	)
+	for len(su) >= 4 {
+		var (
+			sig  = string(su[:2])
+			size = int(su[2])
+		)
+		if size < 4 || size > len(su) {
+			break
+		}
+		data := su[4:size]
+		su = su[size:]
+		switch sig {
+		case "ST":
+			su = nil
+		case "CE":
+			if len(data) < 24 || areas >= 32 {
+				break
+			}
+			var (
+				block  = binary.LittleEndian.Uint32(data[0:])
+				offset = binary.LittleEndian.Uint32(data[8:])
+				length = binary.LittleEndian.Uint32(data[16:])
+			)
+			if length > maxExtent {
+				return fmt.Errorf("%w: continuation area too large", ErrFormat)
+			}
+			more := make([]byte, length)
+			if _, err := r.inner.ReadAt(more, int64(block)*sectorSize+int64(offset)); err != nil {
+				return err
+			}
+			su = append(more, su...)
+			areas++
+		case "PX":
+			if len(data) < 32 {
+				break
+			}
+			e.header.Mode = int64(binary.LittleEndian.Uint32(data[0:]))
+			e.header.Links = int64(binary.LittleEndian.Uint32(data[8:]))
+			e.header.Uid = int64(binary.LittleEndian.Uint32(data[16:]))
+			e.header.Gid = int64(binary.LittleEndian.Uint32(data[24:]))
+			if len(data) >= 36 {
+				e.header.Inode = int64(binary.LittleEndian.Uint32(data[32:]))
+			}
+			if !e.header.IsRegular() {
+				e.header.Size = 0
+			}
+		case "PN":
+			if len(data) < 16 {
+				break
+			}
+			e.header.RMajor = int64(binary.LittleEndian.Uint32(data[0:]))
+			e.header.RMinor = int64(binary.LittleEndian.Uint32(data[8:]))
+		case "TF":
+			if len(data) < 1 {
+				break
+			}
+			if t, ok := parseTimestamps(data); ok {
+				e.header.ModTime = t
+			}
+		case "NM":
+			if len(data) < 1 || data[0]&0x06 != 0 {
+				break
+			}
+			name.Write(data[1:])
+			named = true
+		case "SL":
+			if len(data) < 1 {
+				break
+			}
+			cont = parseLink(&link, data[1:], cont)
+		case "RE":
+			e.skip = true
+		case "CL":
+			if len(data) < 8 {
+				break
+			}
+			child, err := r.relocated(binary.LittleEndian.Uint32(data[0:]))
+			if err != nil {
+				return err
+			}
+			e.extents = child.extents
+			e.header.Mode = child.header.Mode
+			e.header.Links = child.header.Links
+			e.header.Uid = child.header.Uid
+			e.header.Gid = child.header.Gid
+			e.header.ModTime = child.header.ModTime
+			e.header.Size = 0
+			e.flags |= flagDir
+		}
+	}
+	if named {
+		e.name = name.String()
+	}
+	if link.Len() > 0 {
+		e.header.Linkname = link.String()
+		e.header.Size = 0
+	}
+	return nil
+}
+
+// relocated returns the directory relocated at block by reading its own "."
+// record.
+func (r *Reader) relocated(block uint32) (*entry, error) {
+	buf := make([]byte, sectorSize)
+	if _, err := r.inner.ReadAt(buf, int64(block)*sectorSize); err != nil {
+		return nil, err
+	}
+	z := int(buf[0])
+	if z < recordLen || z > len(buf) {
+		return nil, fmt.Errorf("%w: invalid relocated directory", ErrFormat)
+	}
+	e, _, err := r.parseRecord(buf[:z])
+	if err != nil {
+		return nil, err
+	}
+	// the "." record is skipped by parseRecord so its Rock Ridge entries
+	// have to be parsed explicitly.
+	if off := recordLen + 1 + r.skip; off < z {
+		e.skip = false
+		if err := r.parseSystemUse(e, buf[off:z]); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// parseLink appends the components of a SL entry to link. cont tells whether
+// the last component of the previous entry continues in this one. It returns
+// whether the last component of this entry continues in the next one.
+func parseLink(link *strings.Builder, data []byte, cont bool) bool {
+	for len(data) >= 2 {
+		var (
+			flags = data[0]
+			size  = int(data[1])
+		)
+		if 2+size > len(data) {
+			break
+		}
+		comp := data[2 : 2+size]
+		data = data[2+size:]
+		if !cont && link.Len() > 0 && !strings.HasSuffix(link.String(), "/") {
+			link.WriteByte('/')
+		}
+		switch {
+		case flags&0x02 != 0:
+			link.WriteString(".")
+		case flags&0x04 != 0:
+			link.WriteString("..")
+		case flags&0x08 != 0:
+			link.WriteString("/")
+		default:
+			link.Write(comp)
+		}
+		cont = flags&0x01 != 0
+	}
+	return cont
+}
+
+// parseTimestamps returns the modification time recorded in a TF entry.
+func parseTimestamps(data []byte) (time.Time, bool) {
+	var (
+		flags = data[0]
+		size  = 7
+		off   = 1
+	)
+	if flags&0x80 != 0 {
+		size = 17
+	}
+	for bit := byte(0x01); bit <= 0x40; bit <<= 1 {
+		if flags&bit == 0 {
+			continue
+		}
+		if off+size > len(data) {
+			break
+		}
+		if bit == 0x02 {
+			if size == 17 {
+				return parseDateTime(data[off : off+size]), true
+			}
+			return parseRecordTime(data[off : off+size]), true
+		}
+		off += size
+	}
+	return time.Time{}, false
+}
+
+func parseRecordTime(b []byte) time.Time {
+	if b[0] == 0 && b[1] == 0 && b[2] == 0 {
+		return time.Time{}
+	}
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+	t := time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+	return t.UTC()
+}
+
+func parseDateTime(b []byte) time.Time {
+	t, err := time.Parse("20060102150405", string(b[:14]))
+	if err != nil {
+		return time.Time{}
+	}
+	zone := time.FixedZone("", int(int8(b[16]))*15*60)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, zone)
+	return t.UTC()
+}
+
+// isoName returns the name of a file given by its ISO identifier without its
+// version number.
+func isoName(ident string, dir bool) string {
+	if dir {
+		return ident
+	}
+	if x := strings.IndexByte(ident, ';'); x >= 0 {
+		ident = ident[:x]
+	}
+	return strings.TrimSuffix(ident, ".")
+}
@@ -0,0 +1,192 @@
+package mtree
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/midbel/tape"
+)
+
+const signature = "#mtree"
+
+// digests maps the digest algorithms to the mtree keywords. blake2bdigest is
+// an extension of this package: other mtree implementations do not know it
+// and may reject the specifications that use it.
+var digests = map[string]string{
+	tape.SHA256:  "sha256digest",
+	tape.SHA512:  "sha512digest",
+	tape.BLAKE2b: "blake2bdigest",
+}
+
+// Writer writes the entries of an archive as a BSD mtree specification. Each
+// entry is written on its own line with its full path once its content has
+// been written, so the digests of the regular files can be computed.
+type Writer struct {
+	inner *bufio.Writer
+	err   error
+
+	header bool
+	curr   *tape.Header
+	hashes map[string]hash.Hash
+}
+
+// NewWriter returns a Writer computing the digests named by algos of the
+// content of the regular files written to it.
+func NewWriter(w io.Writer, algos ...string) (*Writer, error) {
+	ws := Writer{
+		inner:  bufio.NewWriter(w),
+		hashes: make(map[string]hash.Hash),
+	}
+	for _, a := range algos {
+		h, err := tape.NewHash(a)
+		if err != nil {
+			return nil, err
+		}
+		ws.hashes[a] = h
+	}
+	return &ws, nil
+}
+
+// WriteHeader starts a new entry. The digests found in the Records of h are
+// written as is while the others are computed from the content of the entry.
+func (w *Writer) WriteHeader(h *tape.Header) error {
+	if w.err = w.flushEntry(); w.err != nil {
+		return w.err
+	}
+	x := *h
+	w.curr = &x
+	for _, h := range w.hashes {
+		h.Reset()
+	}
+	return nil
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.curr == nil {
+		return 0, tape.ErrTooLong
+	}
+	for _, h := range w.hashes {
+		h.Write(b)
+	}
+	return len(b), nil
+}
+
+func (w *Writer) Close() error {
+	if w.err = w.flushEntry(); w.err != nil {
+		return w.err
+	}
+	if w.err = w.writeSignature(); w.err != nil {
+		return w.err
+	}
+	w.err = w.inner.Flush()
+	if w.err == nil {
+		w.err = tape.ErrClosed
+		return nil
+	}
+	return w.err
+}
+
+func (w *Writer) flushEntry() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.curr == nil {
+		return nil
+	}
+	h := w.curr
+	w.curr = nil
+	if err := w.writeSignature(); err != nil {
+		return err
+	}
+	var line strings.Builder
+	line.WriteString(Escape(pathName(h.Filename)))
+	fmt.Fprintf(&line, " type=%s", fileType(h))
+	fmt.Fprintf(&line, " mode=%04o", h.Perm())
+	fmt.Fprintf(&line, " uid=%d gid=%d", h.Uid, h.Gid)
+	if !h.ModTime.IsZero() {
+		fmt.Fprintf(&line, " time=%d.%09d", h.ModTime.Unix(), h.ModTime.Nanosecond())
+	}
+	switch {
+	case h.IsSymlink():
+		fmt.Fprintf(&line, " link=%s", Escape(h.Linkname))
+	case h.IsDevice():
+		fmt.Fprintf(&line, " device=native,%d,%d", h.RMajor, h.RMinor)
+	case h.IsRegular() && h.Linkname == "":
+		fmt.Fprintf(&line, " size=%d", h.Size)
+		for _, algo := range []string{tape.SHA256, tape.SHA512, tape.BLAKE2b} {
+			sum, ok := h.Records[tape.DigestPrefix+algo]
+			if hs, computed := w.hashes[algo]; !ok && computed {
+				sum, ok = hex.EncodeToString(hs.Sum(nil)), true
+			}
+			if ok {
+				fmt.Fprintf(&line, " %s=%s", digests[algo], sum)
+			}
+		}
+	}
+	line.WriteString("\n")
+	_, err := w.inner.WriteString(line.String())
+	return err
+}
+
+func (w *Writer) writeSignature() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	_, err := fmt.Fprintln(w.inner, signature)
+	return err
+}
+
+// Escape encodes the characters of str that can not appear as is in a
+// specification with the octal escapes used by mtree.
+func Escape(str string) string {
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case c <= ' ' || c >= 0x7f || c == '\\' || c == '#' || c == '=' || c == '*' || c == '?' || c == '[':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func pathName(name string) string {
+	name = strings.Trim(name, "/")
+	switch {
+	case name == "" || name == ".":
+		return "."
+	case strings.HasPrefix(name, "./"):
+		return name
+	default:
+		return "./" + name
+	}
+}
+
+func fileType(h *tape.Header) string {
+	switch h.Mode & tape.ModeType {
+	case tape.ModeDir:
+		return "dir"
+	case tape.ModeSymlink:
+		return "link"
+	case tape.ModeChar:
+		return "char"
+	case tape.ModeBlock:
+		return "block"
+	case tape.ModeFifo:
+		return "fifo"
+	case tape.ModeSocket:
+		return "socket"
+	default:
+		return "file"
+	}
+}
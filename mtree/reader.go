@@ -0,0 +1,287 @@
+package mtree
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midbel/tape"
+)
+
+// Entry is an entry of a specification. The uname and gname keywords are kept
+// in Uname and Gname: the ids are only set by the uid and gid keywords.
+type Entry struct {
+	tape.Header
+
+	// Contents is the file holding the content of the entry when it is not
+	// the file named as the entry.
+	Contents string
+	// Keywords are all the keywords set for the entry, including the ones
+	// coming from /set.
+	Keywords map[string]string
+}
+
+// Has reports whether the keyword key has been set for the entry.
+func (e *Entry) Has(key string) bool {
+	_, ok := e.Keywords[key]
+	return ok
+}
+
+// Reader reads the entries of a specification. The full paths of the entries
+// are computed for the specifications using relative paths and "..".
+type Reader struct {
+	inner *bufio.Scanner
+	line  int
+
+	set map[string]string
+	dir []string
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		inner: bufio.NewScanner(r),
+		set:   make(map[string]string),
+	}
+}
+
+func (r *Reader) Next() (*Entry, error) {
+	for {
+		line, err := r.nextLine()
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "/set":
+			for k, v := range parseKeywords(fields[1:]) {
+				r.set[k] = v
+			}
+			continue
+		case "/unset":
+			for _, k := range fields[1:] {
+				if k == "all" {
+					r.set = make(map[string]string)
+				}
+				delete(r.set, k)
+			}
+			continue
+		case "..":
+			if len(r.dir) > 0 {
+				r.dir = r.dir[:len(r.dir)-1]
+			}
+			continue
+		}
+		e, err := r.parseEntry(fields)
+		if err != nil {
+			return nil, fmt.Errorf("mtree: line %d: %w", r.line, err)
+		}
+		return e, nil
+	}
+}
+
+func (r *Reader) nextLine() (string, error) {
+	var line strings.Builder
+	for r.inner.Scan() {
+		r.line++
+		str := strings.TrimSpace(r.inner.Text())
+		if line.Len() == 0 && (str == "" || str[0] == '#') {
+			continue
+		}
+		if strings.HasSuffix(str, "\\") && !strings.HasSuffix(str, "\\\\") {
+			line.WriteString(strings.TrimSuffix(str, "\\"))
+			line.WriteString(" ")
+			continue
+		}
+		line.WriteString(str)
+		return line.String(), nil
+	}
+	if err := r.inner.Err(); err != nil {
+		return "", err
+	}
+	if line.Len() > 0 {
+		return line.String(), nil
+	}
+	return "", io.EOF
+}
+
+func (r *Reader) parseEntry(fields []string) (*Entry, error) {
+	name, err := Unescape(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	e := Entry{
+		Keywords: make(map[string]string),
+	}
+	for k, v := range r.set {
+		e.Keywords[k] = v
+	}
+	for k, v := range parseKeywords(fields[1:]) {
+		e.Keywords[k] = v
+	}
+	if strings.Contains(name, "/") {
+		e.Filename = tape.CleanName(name)
+	} else {
+		e.Filename = tape.CleanName(path.Join(append(append([]string{}, r.dir...), name)...))
+		if e.Keywords["type"] == "dir" && name != "." {
+			r.dir = append(r.dir, name)
+		}
+	}
+	if err := e.parseKeywords(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (e *Entry) parseKeywords() error {
+	var err error
+	e.Links = 1
+	switch t := e.Keywords["type"]; t {
+	case "file", "":
+		e.Mode = tape.ModeRegular
+	case "dir":
+		e.Mode = tape.ModeDir
+		e.Links = 2
+	case "link":
+		e.Mode = tape.ModeSymlink
+	case "char":
+		e.Mode = tape.ModeChar
+	case "block":
+		e.Mode = tape.ModeBlock
+	case "fifo":
+		e.Mode = tape.ModeFifo
+	case "socket":
+		e.Mode = tape.ModeSocket
+	default:
+		return fmt.Errorf("%w: unknown type %s", tape.ErrHeader, t)
+	}
+	for k, v := range e.Keywords {
+		switch k {
+		case "mode":
+			var mode int64
+			if mode, err = strconv.ParseInt(v, 8, 64); err == nil {
+				e.Mode |= mode & tape.ModePerm
+			}
+		case "uid":
+			e.Uid, err = strconv.ParseInt(v, 10, 64)
+		case "gid":
+			e.Gid, err = strconv.ParseInt(v, 10, 64)
+		case "uname":
+			e.Uname, err = Unescape(v)
+		case "gname":
+			e.Gname, err = Unescape(v)
+		case "size":
+			e.Size, err = strconv.ParseInt(v, 10, 64)
+		case "nlink":
+			e.Links, err = strconv.ParseInt(v, 10, 64)
+		case "time":
+			e.ModTime, err = parseTime(v)
+		case "link":
+			e.Linkname, err = Unescape(v)
+		case "contents", "content":
+			e.Contents, err = Unescape(v)
+		case "device":
+			e.RMajor, e.RMinor, err = parseDevice(v)
+		case "sha256digest", "sha256":
+			e.setDigest(tape.SHA256, v)
+		case "sha512digest", "sha512":
+			e.setDigest(tape.SHA512, v)
+		case "blake2bdigest":
+			e.setDigest(tape.BLAKE2b, v)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: invalid %s %q", tape.ErrHeader, k, v)
+		}
+	}
+	return nil
+}
+
+func (e *Entry) setDigest(algo, sum string) {
+	if e.Records == nil {
+		e.Records = make(map[string]string)
+	}
+	e.Records[tape.DigestPrefix+algo] = strings.ToLower(sum)
+}
+
+func parseKeywords(fields []string) map[string]string {
+	kws := make(map[string]string)
+	for _, f := range fields {
+		k, v, _ := strings.Cut(f, "=")
+		kws[k] = v
+	}
+	return kws
+}
+
+func parseTime(str string) (time.Time, error) {
+	sec, nsec, _ := strings.Cut(str, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var n uint64
+	if nsec != "" {
+		// the fraction is a decimal part of the second: .5 is 500ms
+		if len(nsec) > 9 {
+			nsec = nsec[:9]
+		}
+		nsec += strings.Repeat("0", 9-len(nsec))
+		if n, err = strconv.ParseUint(nsec, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(s, int64(n)), nil
+}
+
+func parseDevice(str string) (int64, int64, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) != 3 {
+		return 0, 0, errors.New("invalid device")
+	}
+	major, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	minor, err := strconv.ParseInt(parts[2], 10, 64)
+	return major, minor, err
+}
+
+// Unescape decodes the octal escapes and the backslash escapes found in str.
+func Unescape(str string) (string, error) {
+	if !strings.Contains(str, "\\") {
+		return str, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c != '\\' || i == len(str)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c := str[i]; {
+		case c >= '0' && c <= '7':
+			if i+3 > len(str) {
+				return "", fmt.Errorf("%w: invalid escape in %q", tape.ErrHeader, str)
+			}
+			n, err := strconv.ParseUint(str[i:i+3], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("%w: invalid escape in %q", tape.ErrHeader, str)
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		case c == 's':
+			b.WriteByte(' ')
+		case c == 't':
+			b.WriteByte('\t')
+		case c == 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,360 @@
+package tape
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NameKind tells which name of an entry is given to a NameMapper.
+type NameKind int
+
+const (
+	EntryName NameKind = iota
+	SymlinkTarget
+	HardlinkTarget
+)
+
+// NameMapper rewrites the names found in the headers of an archive. When it
+// returns an empty name for an entry or for the target of a hard link, the
+// entry is dropped.
+type NameMapper func(name string, kind NameKind) string
+
+// Apply rewrites the names of h. It reports whether the entry should be kept.
+func (m NameMapper) Apply(h *Header) bool {
+	if h.Filename = m(h.Filename, EntryName); h.Filename == "" {
+		return false
+	}
+	if h.Linkname == "" {
+		return true
+	}
+	if h.IsSymlink() {
+		h.Linkname = m(h.Linkname, SymlinkTarget)
+		return true
+	}
+	h.Linkname = m(h.Linkname, HardlinkTarget)
+	return h.Linkname != ""
+}
+
+// ChainNames returns a NameMapper applying ms in order.
+func ChainNames(ms ...NameMapper) NameMapper {
+	return func(name string, kind NameKind) string {
+		for _, m := range ms {
+			if name == "" {
+				break
+			}
+			name = m(name, kind)
+		}
+		return name
+	}
+}
+
+// StripComponents removes the first n components of the names of the entries
+// and of the targets of the hard links. The names with less than n
+// components are removed. The targets of the symbolic links are left
+// untouched.
+func StripComponents(n int) NameMapper {
+	return func(name string, kind NameKind) string {
+		if kind == SymlinkTarget || n <= 0 {
+			return name
+		}
+		parts := strings.Split(strings.TrimLeft(name, "/"), "/")
+		for i := 0; i < n; {
+			if len(parts) == 0 {
+				return ""
+			}
+			if parts[0] != "" {
+				i++
+			}
+			parts = parts[1:]
+		}
+		return strings.TrimLeft(strings.Join(parts, "/"), "/")
+	}
+}
+
+type transform struct {
+	re     *regexp.Regexp
+	repl   string
+	global bool
+	nth    int
+	kinds  [3]bool
+}
+
+// ParseTransform parses sed-like substitutions in the form s/regexp/repl/flags.
+// Any character can be used in place of the slash and several substitutions
+// can be given separated by semicolons. As with GNU tar, the regular
+// expressions are POSIX basic ones unless the x flag is given, in which case
+// they have the syntax of the regexp package. In repl, & stands for the whole
+// match and \1 to \9 for the submatches.
+//
+// The other flags are the ones of GNU tar: g replaces all the matches, a
+// number n replaces the nth match, i ignores the case, and r, s and h apply the
+// substitution to the names of the entries, to the targets of the symbolic
+// links and to the targets of the hard links while R, S and H do not. A
+// substitution applies to all the names by default.
+func ParseTransform(expr string) (NameMapper, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty substitution")
+	}
+	var ts []transform
+	for rest := expr; rest != ""; {
+		t, r, err := parseTransform(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", expr, err)
+		}
+		ts = append(ts, t)
+		rest = strings.TrimPrefix(r, ";")
+	}
+	return func(name string, kind NameKind) string {
+		for _, t := range ts {
+			if t.kinds[kind] {
+				name = t.apply(name)
+			}
+		}
+		return name
+	}, nil
+}
+
+func parseTransform(expr string) (transform, string, error) {
+	t := transform{
+		kinds: [3]bool{true, true, true},
+	}
+	if len(expr) < 2 || expr[0] != 's' {
+		return t, "", fmt.Errorf("substitution expected")
+	}
+	delim := expr[1]
+	pattern, rest, err := splitTransform(expr[2:], delim)
+	if err != nil {
+		return t, "", err
+	}
+	repl, rest, err := splitTransform(rest, delim)
+	if err != nil {
+		return t, "", err
+	}
+	var fold, extended bool
+	for len(rest) > 0 && rest[0] != ';' {
+		switch c := rest[0]; c {
+		case 'g':
+			t.global = true
+		case 'i':
+			fold = true
+		case 'x':
+			extended = true
+		case 'r', 'R':
+			t.kinds[EntryName] = c == 'r'
+		case 's', 'S':
+			t.kinds[SymlinkTarget] = c == 's'
+		case 'h', 'H':
+			t.kinds[HardlinkTarget] = c == 'h'
+		default:
+			if c < '0' || c > '9' {
+				return t, "", fmt.Errorf("unknown flag %c", c)
+			}
+			x := strings.IndexFunc(rest, func(r rune) bool {
+				return r < '0' || r > '9'
+			})
+			if x < 0 {
+				x = len(rest)
+			}
+			t.nth, _ = strconv.Atoi(rest[:x])
+			rest = rest[x:]
+			continue
+		}
+		rest = rest[1:]
+	}
+	if !extended {
+		pattern = convertBasic(pattern)
+	}
+	if fold {
+		pattern = "(?i)" + pattern
+	}
+	if t.re, err = regexp.Compile(pattern); err != nil {
+		return t, "", err
+	}
+	t.repl = repl
+	return t, rest, nil
+}
+
+// convertBasic converts a POSIX basic regular expression to the syntax of the
+// regexp package.
+func convertBasic(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			switch c = pattern[i]; c {
+			case '(', ')', '{', '}', '|', '+', '?':
+				b.WriteByte(c)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			}
+		case strings.IndexByte("(){}|+?", c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '[':
+			x := bracketEnd(pattern, i)
+			b.WriteString(pattern[i:x])
+			i = x - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// bracketEnd returns the position following the bracket expression starting
+// at i.
+func bracketEnd(pattern string, i int) int {
+	j := i + 1
+	if j < len(pattern) && pattern[j] == '^' {
+		j++
+	}
+	if j < len(pattern) && pattern[j] == ']' {
+		j++
+	}
+	for ; j < len(pattern); j++ {
+		if pattern[j] == ']' {
+			return j + 1
+		}
+	}
+	return len(pattern)
+}
+
+// splitTransform returns the part of str up to the first unescaped delim. The
+// escaped delimiters are unescaped.
+func splitTransform(str string, delim byte) (string, string, error) {
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == delim:
+			return b.String(), str[i+1:], nil
+		case c == '\\' && i+1 < len(str) && str[i+1] == delim:
+			b.WriteByte(delim)
+			i++
+		case c == '\\' && i+1 < len(str):
+			b.WriteByte(c)
+			b.WriteByte(str[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated substitution")
+}
+
+func (t transform) apply(name string) string {
+	nth := t.nth
+	if nth == 0 {
+		nth = 1
+	}
+	var (
+		b    strings.Builder
+		last int
+	)
+	for i, m := range t.re.FindAllStringSubmatchIndex(name, -1) {
+		if i+1 < nth {
+			continue
+		}
+		if i+1 > nth && !t.global {
+			break
+		}
+		b.WriteString(name[last:m[0]])
+		t.expand(&b, name, m)
+		last = m[1]
+	}
+	b.WriteString(name[last:])
+	return b.String()
+}
+
+func (t transform) expand(b *strings.Builder, name string, m []int) {
+	for i := 0; i < len(t.repl); i++ {
+		c := t.repl[i]
+		switch {
+		case c == '&':
+			b.WriteString(name[m[0]:m[1]])
+		case c == '\\' && i+1 < len(t.repl):
+			i++
+			c = t.repl[i]
+			if c < '0' || c > '9' {
+				b.WriteByte(c)
+				break
+			}
+			if x := int(c-'0') * 2; x+1 < len(m) && m[x] >= 0 {
+				b.WriteString(name[m[x]:m[x+1]])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// MapReader returns a Reader rewriting the names of the entries read from r
+// with m. The entries dropped by m are skipped.
+func MapReader(r Reader, m NameMapper) Reader {
+	return &filterReader{
+		Reader: r,
+		keep:   m.Apply,
+	}
+}
+
+// MapWriter returns a Writer rewriting the names of the entries written to w
+// with m. The entries dropped by m are not written.
+func MapWriter(w Writer, m NameMapper) Writer {
+	return &mapWriter{
+		Writer: w,
+		mapper: m,
+	}
+}
+
+// MapNames rewrites the names of the entries with m.
+func MapNames(m NameMapper) Option {
+	return Filter(m.Apply)
+}
+
+// filterReader skips the entries of the underlying Reader for which keep
+// returns false. keep can modify the headers.
+type filterReader struct {
+	Reader
+	keep func(*Header) bool
+}
+
+func (r *filterReader) Next() (*Header, error) {
+	for {
+		h, err := r.Reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if r.keep(h) {
+			return h, nil
+		}
+		if _, err := io.CopyN(io.Discard, r.Reader, h.Size); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type mapWriter struct {
+	Writer
+	mapper NameMapper
+	skip   bool
+}
+
+func (w *mapWriter) WriteHeader(h *Header) error {
+	x := *h
+	if w.skip = !w.mapper.Apply(&x); w.skip {
+		return nil
+	}
+	return w.Writer.WriteHeader(&x)
+}
+
+func (w *mapWriter) Write(b []byte) (int, error) {
+	if w.skip {
+		return len(b), nil
+	}
+	return w.Writer.Write(b)
+}
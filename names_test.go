@@ -0,0 +1,191 @@
+package tape
+
+import (
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	data := []struct {
+		Expr string
+		Name string
+		Kind NameKind
+		Want string
+	}{
+		// examples of the GNU tar manual
+		{Expr: "s,^,prefix/,", Name: "a/b", Want: "prefix/a/b"},
+		{Expr: "s,usr/,usr/local/,", Name: "usr/bin/tar", Want: "usr/local/bin/tar"},
+		{Expr: "s,^,/usr/local/,S", Name: "bin/tar", Kind: SymlinkTarget, Want: "bin/tar"},
+		{Expr: "s,^,/usr/local/,S", Name: "bin/tar", Want: "/usr/local/bin/tar"},
+		{Expr: "s,^,/usr/local/,S", Name: "bin/tar", Kind: HardlinkTarget, Want: "/usr/local/bin/tar"},
+		{Expr: "s/one/two/;s/two/three/", Name: "one", Want: "three"},
+		{Expr: `s/\(.*\)\.tar/\1.old.tar/`, Name: "dir/arch.tar", Want: "dir/arch.old.tar"},
+		// delimiters
+		{Expr: "s|a|b|", Name: "a/a", Want: "b/a"},
+		{Expr: `s/\//_/g`, Name: "a/b/c", Want: "a_b_c"},
+		// nth and global
+		{Expr: "s/a/x/", Name: "aaaa", Want: "xaaa"},
+		{Expr: "s/a/x/g", Name: "aaaa", Want: "xxxx"},
+		{Expr: "s/a/x/3", Name: "aaaa", Want: "aaxa"},
+		{Expr: "s/a/x/2g", Name: "aaaa", Want: "axxx"},
+		{Expr: "s/a/x/5", Name: "aaaa", Want: "aaaa"},
+		// replacement
+		{Expr: "s/b/[&]/", Name: "abc", Want: "a[b]c"},
+		{Expr: `s/b/\&/`, Name: "abc", Want: "a&c"},
+		{Expr: `s/\(a\)\(b\)/\2\1/`, Name: "abc", Want: "bac"},
+		// case
+		{Expr: "s/readme/README/i", Name: "docs/ReadMe", Want: "docs/README"},
+		{Expr: "s/readme/README/", Name: "docs/ReadMe", Want: "docs/ReadMe"},
+		// basic and extended regular expressions
+		{Expr: "s/a+/x/", Name: "aa+", Want: "ax"},
+		{Expr: `s/a\+/x/`, Name: "aa+", Want: "x+"},
+		{Expr: "s/a+/x/x", Name: "aa+", Want: "x+"},
+		{Expr: "s/(b)/x/", Name: "a(b)", Want: "ax"},
+		{Expr: "s/(b)/x/x", Name: "a(b)", Want: "a(x)"},
+		{Expr: "s/[()]/_/g", Name: "a(b)", Want: "a_b_"},
+		{Expr: "s/[]a]/_/g", Name: "a]b", Want: "__b"},
+		{Expr: `s/a\{2\}/x/`, Name: "aaa", Want: "xa"},
+		// kinds
+		{Expr: "s/a/b/r", Name: "a", Kind: SymlinkTarget, Want: "b"},
+		{Expr: "s/a/b/R", Name: "a", Want: "a"},
+		{Expr: "s/a/b/H", Name: "a", Kind: HardlinkTarget, Want: "a"},
+		{Expr: "s/a/b/RSh", Name: "a", Kind: HardlinkTarget, Want: "b"},
+		{Expr: "s/a/b/RSh", Name: "a", Kind: SymlinkTarget, Want: "a"},
+	}
+	for _, d := range data {
+		m, err := ParseTransform(d.Expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", d.Expr, err)
+			continue
+		}
+		if got := m(d.Name, d.Kind); got != d.Want {
+			t.Errorf("%s on %s: want %q, got %q", d.Expr, d.Name, d.Want, got)
+		}
+	}
+}
+
+func TestParseTransformInvalid(t *testing.T) {
+	data := []string{
+		"",
+		"x/a/b/",
+		"s/a/b",
+		"s/a",
+		"s/a/b/z",
+		"s/a/b/;y/a/b/",
+		"s/(/x/x",
+		`s/\(/x/`,
+	}
+	for _, expr := range data {
+		if _, err := ParseTransform(expr); err == nil {
+			t.Errorf("%q: invalid expression accepted", expr)
+		}
+	}
+}
+
+func TestConvertBasic(t *testing.T) {
+	data := []struct {
+		Basic string
+		Want  string
+	}{
+		{Basic: "abc", Want: "abc"},
+		{Basic: `\(a\)`, Want: "(a)"},
+		{Basic: "(a)", Want: `\(a\)`},
+		{Basic: `a\{1,2\}`, Want: "a{1,2}"},
+		{Basic: "a{1,2}", Want: `a\{1,2\}`},
+		{Basic: `a\|b`, Want: "a|b"},
+		{Basic: "a|b", Want: `a\|b`},
+		{Basic: `a\+\?`, Want: "a+?"},
+		{Basic: "a+?", Want: `a\+\?`},
+		{Basic: `\.\*`, Want: `\.\*`},
+		{Basic: "[(|)]", Want: "[(|)]"},
+		{Basic: "[^]()]", Want: "[^]()]"},
+		{Basic: "[]+]+", Want: `[]+]\+`},
+	}
+	for _, d := range data {
+		if got := convertBasic(d.Basic); got != d.Want {
+			t.Errorf("%s: want %s, got %s", d.Basic, d.Want, got)
+		}
+	}
+}
+
+func TestStripComponents(t *testing.T) {
+	data := []struct {
+		Count int
+		Name  string
+		Kind  NameKind
+		Want  string
+	}{
+		{Count: 0, Name: "a/b/c", Want: "a/b/c"},
+		{Count: 1, Name: "a/b/c", Want: "b/c"},
+		{Count: 2, Name: "a/b/c", Want: "c"},
+		{Count: 3, Name: "a/b/c", Want: ""},
+		{Count: 4, Name: "a/b/c", Want: ""},
+		{Count: 1, Name: "/a/b", Want: "b"},
+		{Count: 1, Name: "a//b/c", Want: "b/c"},
+		{Count: 1, Name: "./a/b", Want: "a/b"},
+		{Count: 1, Name: "a/b/", Want: "b/"},
+		{Count: 1, Name: "a/b", Kind: HardlinkTarget, Want: "b"},
+		{Count: 1, Name: "a/b", Kind: SymlinkTarget, Want: "a/b"},
+	}
+	for _, d := range data {
+		if got := StripComponents(d.Count)(d.Name, d.Kind); got != d.Want {
+			t.Errorf("%d on %s: want %q, got %q", d.Count, d.Name, d.Want, got)
+		}
+	}
+}
+
+func TestNameMapperApply(t *testing.T) {
+	m := ChainNames(StripComponents(1), NameMapper(mustTransform(t, "s,^,new/,")))
+	data := []struct {
+		Header Header
+		Keep   bool
+		Name   string
+		Link   string
+	}{
+		{
+			Header: Header{Filename: "old/a", Mode: ModeRegular},
+			Keep:   true,
+			Name:   "new/a",
+		},
+		{
+			Header: Header{Filename: "old", Mode: ModeDir},
+		},
+		{
+			Header: Header{Filename: "old/l", Linkname: "../a", Mode: ModeSymlink},
+			Keep:   true,
+			Name:   "new/l",
+			Link:   "new/../a",
+		},
+		{
+			Header: Header{Filename: "old/h", Linkname: "old/a", Mode: ModeRegular},
+			Keep:   true,
+			Name:   "new/h",
+			Link:   "new/a",
+		},
+		{
+			Header: Header{Filename: "old/h", Linkname: "a", Mode: ModeRegular},
+		},
+	}
+	for _, d := range data {
+		h := d.Header
+		keep := m.Apply(&h)
+		if keep != d.Keep {
+			t.Errorf("%s: want keep %t, got %t", d.Header.Filename, d.Keep, keep)
+			continue
+		}
+		if !keep {
+			continue
+		}
+		if h.Filename != d.Name || h.Linkname != d.Link {
+			t.Errorf("%s: want %s -> %s, got %s -> %s", d.Header.Filename, d.Name, d.Link, h.Filename, h.Linkname)
+		}
+	}
+}
+
+func mustTransform(t *testing.T, expr string) NameMapper {
+	t.Helper()
+	m, err := ParseTransform(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
@@ -0,0 +1,209 @@
+package tape
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IDMap maps a range of ids found in an archive to a range of ids of the
+// host. It has the meaning of a line of /proc/self/uid_map: the Size ids
+// starting at ID are mapped to the ids starting at HostID.
+type IDMap struct {
+	ID     int64
+	HostID int64
+	Size   int64
+}
+
+// ParseIDMap parses an IDMap given as id:hostid:size.
+func ParseIDMap(str string) (IDMap, error) {
+	var (
+		m     IDMap
+		parts = strings.Split(str, ":")
+	)
+	if len(parts) != 3 {
+		return m, fmt.Errorf("%s: id map should be id:hostid:size", str)
+	}
+	for i, p := range []*int64{&m.ID, &m.HostID, &m.Size} {
+		n, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil || n < 0 {
+			return m, fmt.Errorf("%s: invalid id %q", str, parts[i])
+		}
+		*p = n
+	}
+	if m.Size == 0 {
+		return m, fmt.Errorf("%s: empty id map", str)
+	}
+	return m, nil
+}
+
+func mapID(ms []IDMap, id int64) int64 {
+	for _, m := range ms {
+		if id >= m.ID && id < m.ID+m.Size {
+			return m.HostID + id - m.ID
+		}
+	}
+	return id
+}
+
+// Ownership resolves the owner given to the files extracted from an archive.
+//
+// By default, the names of the owner recorded in the archive are preferred
+// to the numeric ids when they exist on the host. Numeric only uses the ids.
+// The owner and the group set with SetOwner and SetGroup replace the ones of
+// all the entries.
+//
+// The ids of the entries can also be remapped, for example to extract a root
+// filesystem for a user namespace. The names recorded in the archive are
+// ignored when a map is given since the ids refer to another system. The ids
+// outside of the maps are left untouched.
+type Ownership struct {
+	Numeric bool
+	UidMaps []IDMap
+	GidMaps []IDMap
+
+	uid    *int64
+	gid    *int64
+	users  map[string]int64
+	groups map[string]int64
+}
+
+// SetOwner sets the owner of all the entries. It is given either as a name
+// that should exist on the host or as a numeric id.
+func (o *Ownership) SetOwner(owner string) error {
+	id, err := LookupUid(owner)
+	if err == nil {
+		o.uid = &id
+	}
+	return err
+}
+
+// SetGroup sets the group of all the entries. It is given either as a name
+// that should exist on the host or as a numeric id.
+func (o *Ownership) SetGroup(group string) error {
+	id, err := LookupGid(group)
+	if err == nil {
+		o.gid = &id
+	}
+	return err
+}
+
+// Resolve returns the uid and the gid to give to the file extracted from h.
+func (o *Ownership) Resolve(h *Header) (int64, int64) {
+	var (
+		uid   = h.Uid
+		gid   = h.Gid
+		names = !o.Numeric && len(o.UidMaps) == 0 && len(o.GidMaps) == 0
+	)
+	if names && o.users == nil {
+		o.users = make(map[string]int64)
+		o.groups = make(map[string]int64)
+	}
+	if names && h.Uname != "" {
+		uid = cachedID(o.users, h.Uname, uid, lookupUser)
+	}
+	if names && h.Gname != "" {
+		gid = cachedID(o.groups, h.Gname, gid, lookupGroup)
+	}
+	uid, gid = mapID(o.UidMaps, uid), mapID(o.GidMaps, gid)
+	if o.uid != nil {
+		uid = *o.uid
+	}
+	if o.gid != nil {
+		gid = *o.gid
+	}
+	return uid, gid
+}
+
+// cachedID returns the id of name on the host or id when name does not exist.
+func cachedID(cache map[string]int64, name string, id int64, lookup func(string) (string, error)) int64 {
+	x, ok := cache[name]
+	if !ok {
+		x = -1
+		if str, err := lookup(name); err == nil {
+			x, _ = strconv.ParseInt(str, 10, 64)
+		}
+		cache[name] = x
+	}
+	if x < 0 {
+		return id
+	}
+	return x
+}
+
+// LookupUid returns the id of the user name on the host. name can also be
+// given as a numeric id.
+func LookupUid(name string) (int64, error) {
+	return lookupID(name, lookupUser)
+}
+
+// LookupGid returns the id of the group name on the host. name can also be
+// given as a numeric id.
+func LookupGid(name string) (int64, error) {
+	return lookupID(name, lookupGroup)
+}
+
+func lookupID(name string, lookup func(string) (string, error)) (int64, error) {
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil && id >= 0 {
+		return id, nil
+	}
+	str, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(str, 10, 64)
+}
+
+func lookupUser(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+func lookupGroup(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
+
+var (
+	namesMu    sync.Mutex
+	userNames  = make(map[int64]string)
+	groupNames = make(map[int64]string)
+)
+
+// userName returns the name of the user uid on the host or an empty string
+// when it does not exist.
+func userName(uid int64) string {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	name, ok := userNames[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.FormatInt(uid, 10)); err == nil {
+			name = u.Username
+		}
+		userNames[uid] = name
+	}
+	return name
+}
+
+// groupName returns the name of the group gid on the host or an empty string
+// when it does not exist.
+func groupName(gid int64) string {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	name, ok := groupNames[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.FormatInt(gid, 10)); err == nil {
+			name = g.Name
+		}
+		groupNames[gid] = name
+	}
+	return name
+}
@@ -0,0 +1,194 @@
+package tape
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpoch returns the time set in the SOURCE_DATE_EPOCH environment
+// variable. The zero time is returned when the variable is not set.
+func SourceDateEpoch() (time.Time, error) {
+	str := os.Getenv("SOURCE_DATE_EPOCH")
+	if str == "" {
+		return time.Time{}, nil
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH: invalid value %q", str)
+	}
+	return time.Unix(n, 0).UTC(), nil
+}
+
+type spooledEntry struct {
+	header Header
+	offset int64
+	size   int64
+}
+
+type reproducibleWriter struct {
+	inner Writer
+	err   error
+	epoch time.Time
+
+	entries []*spooledEntry
+	curr    *spooledEntry
+	spool   *os.File
+	pos     int64
+}
+
+// NewReproducibleWriter returns a Writer that produces the same archive for
+// the same set of entries whatever the order in which they are written and
+// the host on which it runs. The entries are spooled and only written to w,
+// sorted by name, when the Writer is closed. Their owner and device are
+// reset, their inodes are renumbered and their modification time is clamped
+// to epoch when epoch is not the zero time.
+//
+// When w has a SetTime method, like the ISO writer, it is given epoch or, when
+// epoch is the zero time, the most recent modification time of the entries.
+func NewReproducibleWriter(w Writer, epoch time.Time) Writer {
+	return &reproducibleWriter{
+		inner: w,
+		epoch: epoch,
+	}
+}
+
+func (w *reproducibleWriter) WriteHeader(h *Header) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.spool == nil {
+		if w.spool, w.err = os.CreateTemp("", "tape-*"); w.err != nil {
+			return w.err
+		}
+	}
+	e := spooledEntry{
+		header: *h,
+		offset: w.pos,
+	}
+	w.entries = append(w.entries, &e)
+	w.curr = &e
+	return nil
+}
+
+func (w *reproducibleWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.curr == nil {
+		return 0, ErrRead
+	}
+	n, err := w.spool.Write(b)
+	w.curr.size += int64(n)
+	w.pos += int64(n)
+	w.err = err
+	return n, err
+}
+
+func (w *reproducibleWriter) Close() error {
+	if w.spool != nil {
+		defer os.Remove(w.spool.Name())
+		defer w.spool.Close()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.err = ErrClosed
+	sort.SliceStable(w.entries, func(i, j int) bool {
+		return CleanName(w.entries[i].header.Filename) < CleanName(w.entries[j].header.Filename)
+	})
+	var (
+		inodes = w.renumber()
+		newest time.Time
+	)
+	for i, e := range w.entries {
+		w.normalize(&e.header, inodes[i])
+		if e.header.ModTime.After(newest) {
+			newest = e.header.ModTime
+		}
+	}
+	if t, ok := w.inner.(interface{ SetTime(time.Time) }); ok {
+		if !w.epoch.IsZero() {
+			newest = w.epoch
+		}
+		t.SetTime(newest)
+	}
+	for _, e := range w.entries {
+		if err := w.inner.WriteHeader(&e.header); err != nil {
+			return err
+		}
+		if e.size == 0 {
+			continue
+		}
+		if _, err := io.Copy(w.inner, io.NewSectionReader(w.spool, e.offset, e.size)); err != nil {
+			return err
+		}
+	}
+	return w.inner.Close()
+}
+
+type fileID struct {
+	major int64
+	minor int64
+	inode int64
+}
+
+// renumber returns the new inode of each entry. The entries sharing the same
+// device and inode keep sharing the same inode so that the hard links are
+// preserved. Their number of links is set to the number of entries sharing
+// it since the links outside of the archive depend on the host.
+func (w *reproducibleWriter) renumber() []int64 {
+	var (
+		inodes = make([]int64, len(w.entries))
+		seen   = make(map[fileID]int64)
+		links  = make(map[int64]int64)
+		next   int64
+	)
+	for i, e := range w.entries {
+		h := e.header
+		if h.Inode == 0 || h.IsDir() {
+			next++
+			inodes[i] = next
+			continue
+		}
+		id := fileID{
+			major: h.Major,
+			minor: h.Minor,
+			inode: h.Inode,
+		}
+		if _, ok := seen[id]; !ok {
+			next++
+			seen[id] = next
+		}
+		inodes[i] = seen[id]
+		links[inodes[i]]++
+	}
+	for i, e := range w.entries {
+		e.header.Links = 1
+		if n := links[inodes[i]]; n > 1 {
+			e.header.Links = n
+		}
+	}
+	return inodes
+}
+
+func (w *reproducibleWriter) normalize(h *Header, inode int64) {
+	h.Inode = inode
+	h.Uid = 0
+	h.Gid = 0
+	h.Uname = ""
+	h.Gname = ""
+	h.Major = 0
+	h.Minor = 0
+	h.Check = 0
+	if h.IsDir() {
+		h.Links = 2
+	}
+	if !w.epoch.IsZero() && (h.ModTime.IsZero() || h.ModTime.After(w.epoch)) {
+		h.ModTime = w.epoch
+	}
+	h.ModTime = h.ModTime.Truncate(time.Second)
+}
@@ -0,0 +1,278 @@
+package tape
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type CreateFunc func(io.Writer) (Writer, error)
+
+// Edit changes an entry of an archive while it is rewritten. The header and
+// the content returned replace the ones of the entry. Returning a nil header
+// removes the entry from the archive.
+type Edit interface {
+	Apply(*Header, io.Reader) (*Header, io.Reader, error)
+}
+
+type EditFunc func(*Header, io.Reader) (*Header, io.Reader, error)
+
+func (f EditFunc) Apply(h *Header, r io.Reader) (*Header, io.Reader, error) {
+	return f(h, r)
+}
+
+// finisher is implemented by the edits that have to write entries once all
+// the entries of the source archive have been written.
+type finisher interface {
+	finish(Writer) error
+}
+
+// Rewrite copies the entries of r to w after having applied the edits on
+// each of them in the given order.
+func Rewrite(r Reader, w Writer, edits ...Edit) error {
+	return ConvertWith(r, w, WithEdits(edits...))
+}
+
+// RewriteFile rewrites the archive stored in file. The new archive is first
+// written to a temporary file in the same directory that is then renamed to
+// replace the original archive.
+func RewriteFile(file string, open OpenFunc, create CreateFunc, edits ...Edit) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(file)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := rewriteFile(src, tmp, open, create, edits); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func rewriteFile(src io.Reader, dst io.Writer, open OpenFunc, create CreateFunc, edits []Edit) error {
+	r, err := open(src)
+	if err != nil {
+		return err
+	}
+	w, err := create(dst)
+	if err != nil {
+		return err
+	}
+	if err := Rewrite(r, w, edits...); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+type deleteEdit struct {
+	patterns []string
+	deleted  map[string]struct{}
+}
+
+// Delete removes the entries which name matches one of the given patterns.
+// The patterns have the syntax of path.Match. The entries below a removed
+// directory are removed too, and so are the hard links to a removed entry
+// since their content is only stored with the entry they link to.
+func Delete(patterns ...string) Edit {
+	return &deleteEdit{
+		patterns: patterns,
+		deleted:  make(map[string]struct{}),
+	}
+}
+
+func (e *deleteEdit) Apply(h *Header, r io.Reader) (*Header, io.Reader, error) {
+	name := CleanName(h.Filename)
+	if matchAny(e.patterns, name) || e.isDeleted(path.Dir(name)) || e.isLinkDeleted(h) {
+		e.deleted[name] = struct{}{}
+		return nil, r, nil
+	}
+	return h, r, nil
+}
+
+// isDeleted reports whether name or one of its parents has been removed.
+func (e *deleteEdit) isDeleted(name string) bool {
+	for ; name != "."; name = path.Dir(name) {
+		if _, ok := e.deleted[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *deleteEdit) isLinkDeleted(h *Header) bool {
+	if !h.IsRegular() || h.Linkname == "" {
+		return false
+	}
+	return e.isDeleted(CleanName(h.Linkname))
+}
+
+// Rename renames the entry named old. The entries below old when it is a
+// directory are moved under the new name, and the hard links to the moved
+// entries follow them.
+func Rename(old, name string) Edit {
+	old = CleanName(old)
+	rename := func(file string) string {
+		switch file = CleanName(file); {
+		case file == old:
+			return name
+		case strings.HasPrefix(file, old+"/"):
+			return path.Join(name, strings.TrimPrefix(file, old+"/"))
+		default:
+			return ""
+		}
+	}
+	return EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+		if n := rename(h.Filename); n != "" {
+			h.Filename = n
+		}
+		if h.IsRegular() && h.Linkname != "" {
+			if n := rename(h.Linkname); n != "" {
+				h.Linkname = n
+			}
+		}
+		return h, r, nil
+	})
+}
+
+// Chmod changes the permissions of the entries matching pattern.
+func Chmod(pattern string, mode int64) Edit {
+	return EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+		if match(pattern, h.Filename) {
+			h.Mode = (h.Mode &^ ModePerm) | (mode & ModePerm)
+		}
+		return h, r, nil
+	})
+}
+
+// Chown changes the owner of the entries matching pattern. Like os.Chown, a
+// negative uid or gid leaves it unchanged.
+func Chown(pattern string, uid, gid int64) Edit {
+	return EditFunc(func(h *Header, r io.Reader) (*Header, io.Reader, error) {
+		if !match(pattern, h.Filename) {
+			return h, r, nil
+		}
+		if uid >= 0 {
+			h.Uid, h.Uname = uid, userName(uid)
+		}
+		if gid >= 0 {
+			h.Gid, h.Gname = gid, groupName(gid)
+		}
+		return h, r, nil
+	})
+}
+
+type replaceEdit struct {
+	header *Header
+	open   func() (io.ReadCloser, error)
+	done   bool
+}
+
+// Replace replaces the entry named as h with the given header and the content
+// returned by open. Like "ar r", the entry is added at the end of the archive
+// when the archive has no entry with this name.
+func Replace(h *Header, open func() (io.ReadCloser, error)) Edit {
+	return &replaceEdit{
+		header: h,
+		open:   open,
+	}
+}
+
+// ReplaceFile replaces the entry named name by the given file.
+func ReplaceFile(name, file string) (Edit, error) {
+	i, err := os.Lstat(file)
+	if err != nil {
+		return nil, err
+	}
+	h := FileInfoHeaderFromInfo(i)
+	h.Filename = name
+	if h.IsSymlink() {
+		if h.Linkname, err = os.Readlink(file); err != nil {
+			return nil, err
+		}
+	}
+	open := func() (io.ReadCloser, error) {
+		return os.Open(file)
+	}
+	return Replace(h, open), nil
+}
+
+func (e *replaceEdit) Apply(h *Header, r io.Reader) (*Header, io.Reader, error) {
+	if CleanName(h.Filename) != CleanName(e.header.Filename) {
+		return h, r, nil
+	}
+	if e.done {
+		return nil, r, nil
+	}
+	e.done = true
+	return e.content()
+}
+
+func (e *replaceEdit) finish(w Writer) error {
+	if e.done {
+		return nil
+	}
+	e.done = true
+	h, r, err := e.content()
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return writeContent(w, h, r)
+}
+
+func (e *replaceEdit) content() (*Header, io.Reader, error) {
+	x := *e.header
+	if !x.IsRegular() || x.Size == 0 {
+		return &x, strings.NewReader(""), nil
+	}
+	r, err := e.open()
+	return &x, r, err
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(pattern, name string) bool {
+	name = CleanName(name)
+	pattern = CleanName(pattern)
+	if pattern == name {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
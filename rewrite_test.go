@@ -0,0 +1,117 @@
+package tape
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	data := []struct {
+		Name     string
+		Patterns []string
+		Want     []string
+	}{
+		{
+			Name:     "file",
+			Patterns: []string{"dir/a"},
+			Want:     []string{"dir", "dir/b", "dir/sub", "dir/sub/c", "hard->dir/b", "other", "soft=>dir/a"},
+		},
+		{
+			Name:     "directory",
+			Patterns: []string{"dir"},
+			Want:     []string{"other", "soft=>dir/a"},
+		},
+		{
+			Name:     "subdirectory",
+			Patterns: []string{"./dir/sub/"},
+			Want:     []string{"dir", "dir/a", "dir/b", "hard->dir/b", "other", "soft=>dir/a"},
+		},
+		{
+			Name:     "link target",
+			Patterns: []string{"dir/b"},
+			Want:     []string{"dir", "dir/a", "dir/sub", "dir/sub/c", "other", "soft=>dir/a"},
+		},
+		{
+			Name:     "glob",
+			Patterns: []string{"*"},
+			Want:     nil,
+		},
+	}
+	for _, d := range data {
+		got := applyEdit(t, Delete(d.Patterns...))
+		if !reflect.DeepEqual(got, d.Want) {
+			t.Errorf("%s: want %q, got %q", d.Name, d.Want, got)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	data := []struct {
+		Name string
+		Old  string
+		New  string
+		Want []string
+	}{
+		{
+			Name: "file",
+			Old:  "dir/b",
+			New:  "dir/x",
+			Want: []string{"dir", "dir/a", "dir/x", "dir/sub", "dir/sub/c", "hard->dir/x", "other", "soft=>dir/a"},
+		},
+		{
+			Name: "directory",
+			Old:  "dir",
+			New:  "top/new",
+			Want: []string{"top/new", "top/new/a", "top/new/b", "top/new/sub", "top/new/sub/c", "hard->top/new/b", "other", "soft=>dir/a"},
+		},
+		{
+			Name: "prefix",
+			Old:  "di",
+			New:  "x",
+			Want: []string{"dir", "dir/a", "dir/b", "dir/sub", "dir/sub/c", "hard->dir/b", "other", "soft=>dir/a"},
+		},
+	}
+	for _, d := range data {
+		got := applyEdit(t, Rename(d.Old, d.New))
+		if !reflect.DeepEqual(got, d.Want) {
+			t.Errorf("%s: want %q, got %q", d.Name, d.Want, got)
+		}
+	}
+}
+
+// applyEdit applies e to the entries of a small archive and returns the names
+// of the entries kept followed by "->" and the target of hard links or "=>"
+// and the target of symbolic links.
+func applyEdit(t *testing.T, e Edit) []string {
+	t.Helper()
+	entries := []Header{
+		{Filename: "dir", Mode: ModeDir | 0755},
+		{Filename: "dir/a", Mode: ModeRegular | 0644, Size: 1},
+		{Filename: "dir/b", Mode: ModeRegular | 0644, Size: 1},
+		{Filename: "dir/sub", Mode: ModeDir | 0755},
+		{Filename: "dir/sub/c", Mode: ModeRegular | 0644},
+		{Filename: "hard", Mode: ModeRegular | 0644, Linkname: "dir/b"},
+		{Filename: "other", Mode: ModeRegular | 0644},
+		{Filename: "soft", Mode: ModeSymlink | 0777, Linkname: "dir/a"},
+	}
+	var list []string
+	for i := range entries {
+		h, _, err := e.Apply(&entries[i], strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h == nil {
+			continue
+		}
+		name := h.Filename
+		switch {
+		case h.IsSymlink():
+			name += "=>" + h.Linkname
+		case h.Linkname != "":
+			name += "->" + h.Linkname
+		}
+		list = append(list, name)
+	}
+	return list
+}
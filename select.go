@@ -0,0 +1,187 @@
+package tape
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Selection selects the members of an archive by their names. A member is
+// selected when it, or one of its parent directories, matches one of the
+// included patterns and none of the excluded patterns. All the members are
+// selected when no pattern is included.
+//
+// Glob patterns have the syntax of path.Match extended with "**" matching any
+// number of directories.
+type Selection struct {
+	include []*selector
+	exclude []*selector
+}
+
+type selector struct {
+	pattern string
+	match   func(string) bool
+	found   bool
+}
+
+// Include selects the members matching the glob pattern.
+func (s *Selection) Include(pattern string) error {
+	m, err := globSelector(pattern)
+	if err == nil {
+		s.include = append(s.include, m)
+	}
+	return err
+}
+
+// IncludeName selects the member named name. Unlike Include, name is compared
+// literally so the names containing "*", "?" or "[" only select themselves.
+func (s *Selection) IncludeName(name string) {
+	name = CleanName(name)
+	m := selector{
+		pattern: name,
+		match: func(str string) bool {
+			return str == name
+		},
+	}
+	s.include = append(s.include, &m)
+}
+
+// IncludeRegexp selects the members whose name matches the regular
+// expression expr.
+func (s *Selection) IncludeRegexp(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	m := selector{
+		pattern: expr,
+		match:   re.MatchString,
+	}
+	s.include = append(s.include, &m)
+	return nil
+}
+
+// Exclude rejects the members matching the glob pattern. Unlike the included
+// patterns, an excluded pattern is not anchored: it is matched against every
+// sequence of the components of the names so "*.o" excludes "src/main.o".
+func (s *Selection) Exclude(pattern string) error {
+	m, err := globSelector(pattern)
+	if err != nil {
+		return err
+	}
+	match := m.match
+	m.match = func(name string) bool {
+		parts := strings.Split(name, "/")
+		for i := range parts {
+			for j := i + 1; j <= len(parts); j++ {
+				if match(strings.Join(parts[i:j], "/")) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	s.exclude = append(s.exclude, m)
+	return nil
+}
+
+// Match reports whether the member name is selected.
+func (s *Selection) Match(name string) bool {
+	name = CleanName(name)
+	for _, m := range s.exclude {
+		if m.match(name) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	var ok bool
+	for _, m := range s.include {
+		if matchParents(m.match, name) {
+			m.found, ok = true, true
+		}
+	}
+	return ok
+}
+
+// Missing returns the included patterns that have not matched any of the
+// names given to Match.
+func (s *Selection) Missing() []string {
+	var list []string
+	for _, m := range s.include {
+		if !m.found {
+			list = append(list, m.pattern)
+		}
+	}
+	return list
+}
+
+func matchParents(match func(string) bool, name string) bool {
+	for {
+		if match(name) {
+			return true
+		}
+		x := strings.LastIndexByte(name, '/')
+		if x < 0 {
+			return false
+		}
+		name = name[:x]
+	}
+}
+
+func globSelector(pattern string) (*selector, error) {
+	parts := strings.Split(CleanName(pattern), "/")
+	for _, p := range parts {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+	}
+	m := selector{
+		pattern: pattern,
+		match: func(name string) bool {
+			return matchGlob(parts, strings.Split(name, "/"))
+		},
+	}
+	return &m, nil
+}
+
+// matchGlob matches the components of a name against the components of a
+// pattern. A "**" component matches zero or more components of the name.
+func matchGlob(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchGlob(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Reader returns a Reader returning only the entries of r selected by s.
+func (s *Selection) Reader(r Reader) Reader {
+	return &filterReader{
+		Reader: r,
+		keep: func(h *Header) bool {
+			return s.Match(h.Filename)
+		},
+	}
+}
@@ -0,0 +1,170 @@
+package tape
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	data := []struct {
+		Pattern string
+		Name    string
+		Want    bool
+	}{
+		{Pattern: "a/b", Name: "a/b", Want: true},
+		{Pattern: "a/*", Name: "a/b", Want: true},
+		{Pattern: "a/*", Name: "a/b/c", Want: false},
+		{Pattern: "*.go", Name: "main.go", Want: true},
+		{Pattern: "*.go", Name: "cmd/main.go", Want: false},
+		{Pattern: "**", Name: "a/b/c", Want: true},
+		{Pattern: "**/*.go", Name: "main.go", Want: true},
+		{Pattern: "**/*.go", Name: "cmd/tape/main.go", Want: true},
+		{Pattern: "**/*.go", Name: "cmd/tape/main.c", Want: false},
+		{Pattern: "a/**", Name: "a", Want: true},
+		{Pattern: "a/**", Name: "a/b/c", Want: true},
+		{Pattern: "a/**", Name: "b/c", Want: false},
+		{Pattern: "a/**/c", Name: "a/c", Want: true},
+		{Pattern: "a/**/c", Name: "a/b/x/c", Want: true},
+		{Pattern: "a/**/c", Name: "a/b/x/d", Want: false},
+		{Pattern: "a/**/**/c", Name: "a/b/c", Want: true},
+		{Pattern: "a/b?/[cd]", Name: "a/bx/d", Want: true},
+		{Pattern: "a/b?/[cd]", Name: "a/b/d", Want: false},
+	}
+	for _, d := range data {
+		got := matchGlob(strings.Split(d.Pattern, "/"), strings.Split(d.Name, "/"))
+		if got != d.Want {
+			t.Errorf("%s ~ %s: want %t, got %t", d.Pattern, d.Name, d.Want, got)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	data := []struct {
+		Name     string
+		Include  []string
+		Names    []string
+		Exclude  []string
+		Regexps  []string
+		Selected []string
+		Rejected []string
+	}{
+		{
+			Name:     "empty",
+			Selected: []string{"a", "a/b", "./c"},
+		},
+		{
+			Name:     "include parents",
+			Include:  []string{"src"},
+			Selected: []string{"src", "src/main.go", "./src/tape/tape.go"},
+			Rejected: []string{"srcs", "doc/src"},
+		},
+		{
+			Name:     "include glob",
+			Include:  []string{"**/*.go"},
+			Selected: []string{"main.go", "src/main.go"},
+			Rejected: []string{"src/main.c"},
+		},
+		{
+			Name:     "exclude unanchored",
+			Exclude:  []string{"*.o"},
+			Selected: []string{"src/main.c", "src"},
+			Rejected: []string{"main.o", "src/main.o", "src/lib/x.o"},
+		},
+		{
+			Name:     "exclude directory",
+			Exclude:  []string{"vendor"},
+			Selected: []string{"src/main.go"},
+			Rejected: []string{"vendor", "vendor/a/b.go", "src/vendor/c.go"},
+		},
+		{
+			Name:     "exclude sequence",
+			Exclude:  []string{"a/b"},
+			Selected: []string{"a/c", "b/a"},
+			Rejected: []string{"a/b", "x/a/b", "x/a/b/c"},
+		},
+		{
+			Name:     "exclude wins",
+			Include:  []string{"src"},
+			Exclude:  []string{"*_test.go"},
+			Selected: []string{"src/main.go"},
+			Rejected: []string{"src/main_test.go", "doc/main.go"},
+		},
+		{
+			Name:     "regexp",
+			Regexps:  []string{`\.(c|h)$`},
+			Selected: []string{"main.c", "include/tape.h"},
+			Rejected: []string{"main.go"},
+		},
+		{
+			Name:     "literal names",
+			Names:    []string{"data/[1].txt", "*"},
+			Selected: []string{"data/[1].txt", "*"},
+			Rejected: []string{"data/1.txt", "main.go"},
+		},
+	}
+	for _, d := range data {
+		var s Selection
+		for _, p := range d.Include {
+			if err := s.Include(p); err != nil {
+				t.Fatalf("%s: %s", d.Name, err)
+			}
+		}
+		for _, n := range d.Names {
+			s.IncludeName(n)
+		}
+		for _, p := range d.Exclude {
+			if err := s.Exclude(p); err != nil {
+				t.Fatalf("%s: %s", d.Name, err)
+			}
+		}
+		for _, p := range d.Regexps {
+			if err := s.IncludeRegexp(p); err != nil {
+				t.Fatalf("%s: %s", d.Name, err)
+			}
+		}
+		for _, n := range d.Selected {
+			if !s.Match(n) {
+				t.Errorf("%s: %s should be selected", d.Name, n)
+			}
+		}
+		for _, n := range d.Rejected {
+			if s.Match(n) {
+				t.Errorf("%s: %s should be rejected", d.Name, n)
+			}
+		}
+	}
+}
+
+func TestSelectionMissing(t *testing.T) {
+	var s Selection
+	for _, p := range []string{"src", "doc/*.md", "**/*.c"} {
+		if err := s.Include(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.IncludeName("README")
+	if err := s.Exclude("*.c"); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{"src/main.go", "lib/x.c", "README"} {
+		s.Match(n)
+	}
+	want := []string{"doc/*.md", "**/*.c"}
+	if got := s.Missing(); !reflect.DeepEqual(got, want) {
+		t.Errorf("missing: want %q, got %q", want, got)
+	}
+}
+
+func TestSelectionInvalid(t *testing.T) {
+	var s Selection
+	if err := s.Include("a/[b"); err == nil {
+		t.Errorf("include: invalid pattern accepted")
+	}
+	if err := s.Exclude("[]"); err == nil {
+		t.Errorf("exclude: invalid pattern accepted")
+	}
+	if err := s.IncludeRegexp("("); err == nil {
+		t.Errorf("regexp: invalid expression accepted")
+	}
+}
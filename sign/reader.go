@@ -0,0 +1,174 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/midbel/tape"
+)
+
+// digestReader computes the digest of the bytes read from the underlying
+// reader. Since the readers of the archives read ahead, the bytes are kept
+// until the position up to which they have to be hashed is known.
+type digestReader struct {
+	inner   io.Reader
+	digest  hash.Hash
+	pending bytes.Buffer
+	hashed  int64
+}
+
+func (r *digestReader) Read(b []byte) (int, error) {
+	n, err := r.inner.Read(b)
+	r.pending.Write(b[:n])
+	return n, err
+}
+
+func (r *digestReader) hashAll() {
+	r.hashUntil(r.hashed + int64(r.pending.Len()))
+}
+
+func (r *digestReader) hashUntil(pos int64) {
+	if n := pos - r.hashed; n > 0 {
+		b := r.pending.Next(int(n))
+		r.digest.Write(b)
+		r.hashed += int64(len(b))
+	}
+}
+
+// Reader is a tape.Reader checking the signature of the archive read. The
+// signature is only checked once the end of the archive is reached: the
+// entries returned before Next returns io.EOF should not be trusted.
+type Reader struct {
+	tape.Reader
+
+	offset tape.Offsetter
+	raw    *digestReader
+	key    ed25519.PublicKey
+	sig    []byte
+	read   int64
+	done   bool
+	err    error
+}
+
+// NewReader returns a Reader checking the signature embedded in the tar
+// archive read from r as its last entry.
+func NewReader(r io.Reader, open tape.OpenFunc, key ed25519.PublicKey) (*Reader, error) {
+	rs, err := newReader(r, open, key)
+	if err != nil {
+		return nil, err
+	}
+	off, ok := rs.Reader.(tape.Offsetter)
+	if !ok {
+		return nil, fmt.Errorf("%w: reader can not report offsets", tape.ErrUnsupported)
+	}
+	rs.offset = off
+	return rs, nil
+}
+
+// NewDetachedReader returns a Reader checking that sig is the signature of
+// the whole stream read from r.
+func NewDetachedReader(r io.Reader, open tape.OpenFunc, key ed25519.PublicKey, sig []byte) (*Reader, error) {
+	rs, err := newReader(r, open, key)
+	if err != nil {
+		return nil, err
+	}
+	rs.sig = sig
+	return rs, nil
+}
+
+func newReader(r io.Reader, open tape.OpenFunc, key ed25519.PublicKey) (*Reader, error) {
+	raw := digestReader{
+		inner:  r,
+		digest: sha512.New(),
+	}
+	inner, err := open(&raw)
+	if err != nil {
+		return nil, err
+	}
+	rs := Reader{
+		Reader: inner,
+		raw:    &raw,
+		key:    key,
+	}
+	return &rs, nil
+}
+
+func (r *Reader) Next() (*tape.Header, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	h, err := r.Reader.Next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = r.verify()
+		}
+		r.err = err
+		return nil, err
+	}
+	r.read = 0
+	if r.offset == nil {
+		r.raw.hashAll()
+		return h, nil
+	}
+	if r.done {
+		r.err = fmt.Errorf("%w: entries found after the signature", ErrSignature)
+		return nil, r.err
+	}
+	pos, _ := r.offset.Offset()
+	r.raw.hashUntil(pos)
+	if h.Filename != EntryName {
+		return h, nil
+	}
+	if h.Size != ed25519.SignatureSize {
+		r.err = fmt.Errorf("%w: signature of %d bytes", ErrSignature, h.Size)
+		return nil, r.err
+	}
+	sum := r.raw.digest.Sum(nil)
+	sig := make([]byte, h.Size)
+	if _, err := io.ReadFull(r.Reader, sig); err != nil {
+		r.err = err
+		return nil, err
+	}
+	r.sig, r.done = sig, true
+	if r.err = verify(r.key, sum, sig); r.err != nil {
+		return nil, r.err
+	}
+	return r.Next()
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.Reader.Read(b)
+	r.read += int64(n)
+	if r.offset == nil {
+		r.raw.hashAll()
+	} else {
+		_, data := r.offset.Offset()
+		r.raw.hashUntil(data + r.read)
+	}
+	return n, err
+}
+
+func (r *Reader) verify() error {
+	if r.offset != nil {
+		if !r.done {
+			return ErrMissing
+		}
+		return io.EOF
+	}
+	if _, err := io.Copy(io.Discard, r.raw); err != nil {
+		return err
+	}
+	r.raw.hashAll()
+	if err := verify(r.key, r.raw.digest.Sum(nil), r.sig); err != nil {
+		return err
+	}
+	return io.EOF
+}
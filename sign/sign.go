@@ -0,0 +1,166 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/midbel/tape"
+	"github.com/midbel/tape/tar"
+)
+
+// EntryName is the name of the entry holding the signature of a signed tar
+// archive. It is always the last entry of the archive.
+const EntryName = ".tape.sig"
+
+var (
+	ErrSignature = errors.New("sign: invalid signature")
+	ErrMissing   = errors.New("sign: signature not found")
+	ErrKey       = errors.New("sign: invalid key")
+)
+
+// Sign computes the signature of the data read from r.
+func Sign(r io.Reader, key ed25519.PrivateKey) ([]byte, error) {
+	sum := sha512.New()
+	if _, err := io.Copy(sum, r); err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(key, sum.Sum(nil)), nil
+}
+
+// Verify checks that sig is the signature of the data read from r.
+func Verify(r io.Reader, key ed25519.PublicKey, sig []byte) error {
+	sum := sha512.New()
+	if _, err := io.Copy(sum, r); err != nil {
+		return err
+	}
+	return verify(key, sum.Sum(nil), sig)
+}
+
+func verify(key ed25519.PublicKey, sum, sig []byte) error {
+	if !ed25519.Verify(key, sum, sig) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// WriteSignature writes sig as it is stored in a detached signature file.
+func WriteSignature(w io.Writer, sig []byte) error {
+	_, err := fmt.Fprintln(w, base64.StdEncoding.EncodeToString(sig))
+	return err
+}
+
+// ReadSignature reads a signature written by WriteSignature.
+func ReadSignature(r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, ErrSignature
+	}
+	return sig, nil
+}
+
+// ReadPrivateKey reads a PEM encoded PKCS #8 ed25519 private key from file.
+func ReadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: not an ed25519 key", file, ErrKey)
+	}
+	return key, nil
+}
+
+// ReadPublicKey reads a PEM encoded PKIX ed25519 public key from file. The
+// public key is derived from the private key when file holds a private key.
+func ReadPublicKey(file string) (ed25519.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		key, err := ReadPrivateKey(file)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: not an ed25519 key", file, ErrKey)
+	}
+	return key, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: %w: no PEM data", file, ErrKey)
+	}
+	return block, nil
+}
+
+// Writer writes a tar archive which last entry is the signature of all the
+// bytes written before it.
+type Writer struct {
+	*tar.TapeWriter
+
+	key    ed25519.PrivateKey
+	digest hash.Hash
+}
+
+func NewWriter(w io.Writer, key ed25519.PrivateKey) *Writer {
+	sum := sha512.New()
+	return &Writer{
+		TapeWriter: tar.NewTapeWriter(io.MultiWriter(w, sum)),
+		key:        key,
+		digest:     sum,
+	}
+}
+
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	sig := ed25519.Sign(w.key, w.digest.Sum(nil))
+	h := tape.Header{
+		Filename: EntryName,
+		Mode:     tape.ModeRegular | 0644,
+		Size:     int64(len(sig)),
+		ModTime:  time.Unix(0, 0),
+		Links:    1,
+	}
+	if err := w.WriteHeader(&h); err != nil {
+		return err
+	}
+	if _, err := w.Write(sig); err != nil {
+		return err
+	}
+	return w.TapeWriter.Close()
+}
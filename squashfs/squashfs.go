@@ -0,0 +1,704 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/midbel/tape"
+	"github.com/ulikunitz/xz"
+)
+
+const Magic = 0x73717368
+
+const (
+	metaSize   = 8192
+	noFragment = 0xFFFFFFFF
+	fragSize   = 16
+	blockMask  = 0xFFFFFF
+	blockRaw   = 1 << 24
+	metaRaw    = 1 << 15
+
+	minBlockSize = 4 << 10
+	maxBlockSize = 1 << 20
+)
+
+// flagCompOptions is set in the flags of the superblock when the options of
+// the compressor are stored after the superblock.
+const flagCompOptions = 0x0400
+
+const (
+	compGzip = 1 + iota
+	compLzma
+	compLzo
+	compXz
+	compLz4
+	compZstd
+)
+
+const (
+	typeDir = 1 + iota
+	typeFile
+	typeSymlink
+	typeBlock
+	typeChar
+	typeFifo
+	typeSocket
+	typeLDir
+	typeLFile
+	typeLSymlink
+	typeLBlock
+	typeLChar
+	typeLFifo
+	typeLSocket
+)
+
+var le = binary.LittleEndian
+
+type superblock struct {
+	Magic       uint32
+	Inodes      uint32
+	ModTime     uint32
+	BlockSize   uint32
+	Fragments   uint32
+	Compression uint16
+	BlockLog    uint16
+	Flags       uint16
+	Ids         uint16
+	Major       uint16
+	Minor       uint16
+	Root        uint64
+	BytesUsed   uint64
+	IdTable     uint64
+	XattrTable  uint64
+	InodeTable  uint64
+	DirTable    uint64
+	FragTable   uint64
+	ExportTable uint64
+}
+
+type fragment struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+type inodeHeader struct {
+	Type   uint16
+	Perm   uint16
+	Uid    uint16
+	Gid    uint16
+	Mtime  uint32
+	Number uint32
+}
+
+type inode struct {
+	inodeHeader
+
+	links uint32
+	size  uint64
+
+	start  uint64
+	frag   uint32
+	offset uint32
+	blocks []uint32
+
+	dirBlock  uint32
+	dirOffset uint16
+
+	target string
+	dev    uint32
+}
+
+func (i inode) isDir() bool {
+	return i.Type == typeDir || i.Type == typeLDir
+}
+
+func (i inode) mode() int64 {
+	var mode int64
+	switch i.Type {
+	case typeDir, typeLDir:
+		mode = tape.ModeDir
+	case typeFile, typeLFile:
+		mode = tape.ModeRegular
+	case typeSymlink, typeLSymlink:
+		mode = tape.ModeSymlink
+	case typeBlock, typeLBlock:
+		mode = tape.ModeBlock
+	case typeChar, typeLChar:
+		mode = tape.ModeChar
+	case typeFifo, typeLFifo:
+		mode = tape.ModeFifo
+	case typeSocket, typeLSocket:
+		mode = tape.ModeSocket
+	}
+	return mode | int64(i.Perm)&tape.ModePerm
+}
+
+type entry struct {
+	name   string
+	block  uint32
+	offset uint16
+}
+
+type directory struct {
+	prefix  string
+	entries []entry
+}
+
+// Reader walks the directory tree of a SquashFS 4.0 image and returns its
+// entries in depth first order. Only images compressed with gzip or xz are
+// supported: lzma, lzo, lz4 and zstd are rejected with tape.ErrUnsupported
+// as are xz images using the branch/call/jump filters of mksquashfs -Xbcj,
+// which are detected from the options of the compressor.
+type Reader struct {
+	inner io.ReaderAt
+	curr  io.Reader
+	err   error
+
+	super superblock
+	ids   []uint32
+	frags []fragment
+	stack []*directory
+
+	cache struct {
+		index uint32
+		data  []byte
+	}
+}
+
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	rs := Reader{
+		inner: r,
+	}
+	if err := rs.readSuperblock(); err != nil {
+		return nil, err
+	}
+	if err := rs.readIds(); err != nil {
+		return nil, err
+	}
+	if err := rs.readFragments(); err != nil {
+		return nil, err
+	}
+	rs.cache.index = noFragment
+
+	root, err := rs.readInode(rs.super.Root>>16, uint16(rs.super.Root&0xFFFF))
+	if err != nil {
+		return nil, err
+	}
+	if !root.isDir() {
+		return nil, fmt.Errorf("squashfs: root inode is not a directory")
+	}
+	if err := rs.pushDir("", root); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.curr == nil {
+		return 0, tape.ErrRead
+	}
+	n, err := r.curr.Read(b)
+	if errors.Is(err, io.EOF) {
+		r.curr = nil
+	} else if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *Reader) Next() (*tape.Header, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.curr = nil
+	for len(r.stack) > 0 {
+		d := r.stack[len(r.stack)-1]
+		if len(d.entries) == 0 {
+			r.stack = r.stack[:len(r.stack)-1]
+			continue
+		}
+		e := d.entries[0]
+		d.entries = d.entries[1:]
+
+		i, err := r.readInode(uint64(e.block), e.offset)
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		h := r.header(path.Join(d.prefix, e.name), i)
+		switch {
+		case i.isDir():
+			r.err = r.pushDir(h.Filename, i)
+		case h.IsRegular():
+			r.curr = &fileReader{
+				reader: r,
+				inode:  i,
+				pos:    int64(i.start),
+			}
+		}
+		return h, r.err
+	}
+	return nil, io.EOF
+}
+
+func (r *Reader) header(name string, i inode) *tape.Header {
+	h := tape.Header{
+		Filename: name,
+		Inode:    int64(i.Number),
+		Mode:     i.mode(),
+		Links:    int64(i.links),
+		ModTime:  time.Unix(int64(i.Mtime), 0).UTC(),
+		Linkname: i.target,
+	}
+	if int(i.Uid) < len(r.ids) {
+		h.Uid = int64(r.ids[i.Uid])
+	}
+	if int(i.Gid) < len(r.ids) {
+		h.Gid = int64(r.ids[i.Gid])
+	}
+	if h.IsRegular() {
+		h.Size = int64(i.size)
+	}
+	if h.IsDevice() {
+		h.RMajor = int64((i.dev & 0xFFF00) >> 8)
+		h.RMinor = int64((i.dev & 0xFF) | ((i.dev >> 12) & 0xFFF00))
+	}
+	return &h
+}
+
+func (r *Reader) pushDir(prefix string, i inode) error {
+	d := directory{
+		prefix: prefix,
+	}
+	if i.size > 3 {
+		m, err := r.openMeta(r.super.DirTable+uint64(i.dirBlock), i.dirOffset)
+		if err != nil {
+			return err
+		}
+		d.entries, err = readEntries(io.LimitReader(m, int64(i.size-3)))
+		if err != nil {
+			return err
+		}
+	}
+	r.stack = append(r.stack, &d)
+	return nil
+}
+
+func readEntries(r io.Reader) ([]entry, error) {
+	var es []entry
+	for {
+		var dh struct {
+			Count  uint32
+			Start  uint32
+			Number uint32
+		}
+		if err := binary.Read(r, le, &dh); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		for i := 0; i <= int(dh.Count); i++ {
+			var de struct {
+				Offset uint16
+				Delta  int16
+				Type   uint16
+				Size   uint16
+			}
+			if err := binary.Read(r, le, &de); err != nil {
+				return nil, err
+			}
+			name := make([]byte, int(de.Size)+1)
+			if _, err := io.ReadFull(r, name); err != nil {
+				return nil, err
+			}
+			e := entry{
+				name:   string(name),
+				block:  dh.Start,
+				offset: de.Offset,
+			}
+			es = append(es, e)
+		}
+	}
+	return es, nil
+}
+
+func (r *Reader) readInode(block uint64, offset uint16) (inode, error) {
+	var i inode
+	m, err := r.openMeta(r.super.InodeTable+block, offset)
+	if err != nil {
+		return i, err
+	}
+	if err := binary.Read(m, le, &i.inodeHeader); err != nil {
+		return i, err
+	}
+	switch i.Type {
+	case typeDir:
+		var v struct {
+			Block  uint32
+			Links  uint32
+			Size   uint16
+			Offset uint16
+			Parent uint32
+		}
+		err = binary.Read(m, le, &v)
+		i.dirBlock, i.links, i.size, i.dirOffset = v.Block, v.Links, uint64(v.Size), v.Offset
+	case typeLDir:
+		var v struct {
+			Links  uint32
+			Size   uint32
+			Block  uint32
+			Parent uint32
+			Count  uint16
+			Offset uint16
+			Xattr  uint32
+		}
+		err = binary.Read(m, le, &v)
+		i.dirBlock, i.links, i.size, i.dirOffset = v.Block, v.Links, uint64(v.Size), v.Offset
+	case typeFile:
+		var v struct {
+			Start  uint32
+			Frag   uint32
+			Offset uint32
+			Size   uint32
+		}
+		err = binary.Read(m, le, &v)
+		i.start, i.frag, i.offset, i.size, i.links = uint64(v.Start), v.Frag, v.Offset, uint64(v.Size), 1
+		if err == nil {
+			err = r.readBlockList(m, &i)
+		}
+	case typeLFile:
+		var v struct {
+			Start  uint64
+			Size   uint64
+			Sparse uint64
+			Links  uint32
+			Frag   uint32
+			Offset uint32
+			Xattr  uint32
+		}
+		err = binary.Read(m, le, &v)
+		i.start, i.frag, i.offset, i.size, i.links = v.Start, v.Frag, v.Offset, v.Size, v.Links
+		if err == nil {
+			err = r.readBlockList(m, &i)
+		}
+	case typeSymlink, typeLSymlink:
+		var v struct {
+			Links uint32
+			Size  uint32
+		}
+		if err = binary.Read(m, le, &v); err != nil {
+			break
+		}
+		target := make([]byte, v.Size)
+		if _, err = io.ReadFull(m, target); err == nil {
+			i.links, i.target = v.Links, string(target)
+		}
+	case typeBlock, typeChar, typeLBlock, typeLChar:
+		var v struct {
+			Links uint32
+			Dev   uint32
+		}
+		err = binary.Read(m, le, &v)
+		i.links, i.dev = v.Links, v.Dev
+	case typeFifo, typeSocket, typeLFifo, typeLSocket:
+		err = binary.Read(m, le, &i.links)
+	default:
+		err = fmt.Errorf("squashfs: unknown inode type %d", i.Type)
+	}
+	return i, err
+}
+
+func (r *Reader) readBlockList(m io.Reader, i *inode) error {
+	var (
+		size  = uint64(r.super.BlockSize)
+		count = i.size / size
+	)
+	if i.frag == noFragment && i.size%size != 0 {
+		count++
+	}
+	i.blocks = make([]uint32, count)
+	return binary.Read(m, le, i.blocks)
+}
+
+func (r *Reader) readSuperblock() error {
+	sr := io.NewSectionReader(r.inner, 0, int64(binary.Size(r.super)))
+	if err := binary.Read(sr, le, &r.super); err != nil {
+		return err
+	}
+	if r.super.Magic != Magic {
+		return tape.ErrMagic
+	}
+	if r.super.Major != 4 {
+		return fmt.Errorf("%w: squashfs version %d.%d", tape.ErrUnsupported, r.super.Major, r.super.Minor)
+	}
+	if z := r.super.BlockSize; z < minBlockSize || z > maxBlockSize || z&(z-1) != 0 {
+		return fmt.Errorf("squashfs: invalid block size %d", z)
+	}
+	switch r.super.Compression {
+	case compGzip:
+	case compXz:
+		return r.readXzOptions()
+	case compLzma:
+		return fmt.Errorf("%w: lzma compression", tape.ErrUnsupported)
+	case compLzo:
+		return fmt.Errorf("%w: lzo compression", tape.ErrUnsupported)
+	case compLz4:
+		return fmt.Errorf("%w: lz4 compression", tape.ErrUnsupported)
+	case compZstd:
+		return fmt.Errorf("%w: zstd compression", tape.ErrUnsupported)
+	default:
+		return fmt.Errorf("%w: compression %d", tape.ErrUnsupported, r.super.Compression)
+	}
+	return nil
+}
+
+// readXzOptions rejects the images whose blocks are compressed with xz
+// filters other than lzma2. The options, when present, are a dictionary size
+// followed by a bit mask of the filters.
+func (r *Reader) readXzOptions() error {
+	if r.super.Flags&flagCompOptions == 0 {
+		return nil
+	}
+	m, err := r.openMeta(uint64(binary.Size(r.super)), 0)
+	if err != nil {
+		return err
+	}
+	var opts struct {
+		Dict    uint32
+		Filters uint32
+	}
+	if err := binary.Read(m, le, &opts); err != nil {
+		return err
+	}
+	if opts.Filters != 0 {
+		return fmt.Errorf("%w: xz filters %#x", tape.ErrUnsupported, opts.Filters)
+	}
+	return nil
+}
+
+func (r *Reader) readIds() error {
+	r.ids = make([]uint32, r.super.Ids)
+	return r.readTable(r.super.IdTable, len(r.ids), 4, func(m io.Reader, n int) error {
+		return binary.Read(m, le, r.ids[n:n+1])
+	})
+}
+
+func (r *Reader) readFragments() error {
+	r.frags = make([]fragment, r.super.Fragments)
+	return r.readTable(r.super.FragTable, len(r.frags), fragSize, func(m io.Reader, n int) error {
+		return binary.Read(m, le, &r.frags[n])
+	})
+}
+
+// readTable reads count items of the given size stored in the metadata blocks
+// referenced by the list of pointers found at offset.
+func (r *Reader) readTable(offset uint64, count, size int, read func(io.Reader, int) error) error {
+	if count == 0 {
+		return nil
+	}
+	var (
+		per  = metaSize / size
+		ptrs = make([]uint64, (count+per-1)/per)
+		sr   = io.NewSectionReader(r.inner, int64(offset), int64(len(ptrs)*8))
+	)
+	if err := binary.Read(sr, le, ptrs); err != nil {
+		return err
+	}
+	for i, p := range ptrs {
+		m, err := r.openMeta(p, 0)
+		if err != nil {
+			return err
+		}
+		for j := i * per; j < count && j < (i+1)*per; j++ {
+			if err := read(m, j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Reader) openMeta(pos uint64, offset uint16) (*metaReader, error) {
+	m := metaReader{
+		reader: r,
+		pos:    int64(pos),
+	}
+	if err := m.fill(); err != nil {
+		return nil, err
+	}
+	if int(offset) > len(m.buf) {
+		return nil, fmt.Errorf("squashfs: invalid metadata offset %d", offset)
+	}
+	m.buf = m.buf[offset:]
+	return &m, nil
+}
+
+func (r *Reader) readFragment(index uint32) ([]byte, error) {
+	if r.cache.index == index {
+		return r.cache.data, nil
+	}
+	if int(index) >= len(r.frags) {
+		return nil, fmt.Errorf("squashfs: invalid fragment %d", index)
+	}
+	f := r.frags[index]
+	data, err := r.readBlock(int64(f.Start), f.Size)
+	if err == nil {
+		r.cache.index = index
+		r.cache.data = data
+	}
+	return data, err
+}
+
+func (r *Reader) readBlock(pos int64, size uint32) ([]byte, error) {
+	buf := make([]byte, size&blockMask)
+	if _, err := r.inner.ReadAt(buf, pos); err != nil {
+		return nil, err
+	}
+	if size&blockRaw != 0 {
+		return buf, nil
+	}
+	return r.decompress(buf, int(r.super.BlockSize))
+}
+
+// decompress decompresses the block b which can not be larger than limit
+// bytes once decompressed.
+func (r *Reader) decompress(b []byte, limit int) ([]byte, error) {
+	var z io.Reader
+	if r.super.Compression == compXz {
+		x, err := xz.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		z = x
+	} else {
+		x, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer x.Close()
+		z = x
+	}
+	data, err := io.ReadAll(io.LimitReader(z, int64(limit)+1))
+	if err == nil && len(data) > limit {
+		err = fmt.Errorf("squashfs: block larger than %d bytes", limit)
+	}
+	return data, err
+}
+
+type metaReader struct {
+	reader *Reader
+	pos    int64
+	buf    []byte
+}
+
+func (m *metaReader) Read(b []byte) (int, error) {
+	if len(m.buf) == 0 {
+		if err := m.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+func (m *metaReader) fill() error {
+	var (
+		buf = make([]byte, 2)
+		r   = m.reader
+	)
+	if _, err := r.inner.ReadAt(buf, m.pos); err != nil {
+		return err
+	}
+	var (
+		size = le.Uint16(buf)
+		data = make([]byte, size&^metaRaw)
+	)
+	if _, err := r.inner.ReadAt(data, m.pos+2); err != nil {
+		return err
+	}
+	m.pos += int64(len(data)) + 2
+	if size&metaRaw != 0 {
+		m.buf = data
+		return nil
+	}
+	var err error
+	m.buf, err = r.decompress(data, metaSize)
+	return err
+}
+
+type fileReader struct {
+	reader *Reader
+	inode  inode
+	pos    int64
+	read   uint64
+	buf    []byte
+}
+
+func (f *fileReader) Read(b []byte) (int, error) {
+	if len(f.buf) == 0 {
+		if f.read >= f.inode.size {
+			return 0, io.EOF
+		}
+		if err := f.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, f.buf)
+	f.buf = f.buf[n:]
+	f.read += uint64(n)
+	return n, nil
+}
+
+func (f *fileReader) fill() error {
+	var (
+		r    = f.reader
+		size = uint64(r.super.BlockSize)
+		rest = f.inode.size - f.read
+	)
+	if len(f.inode.blocks) > 0 {
+		z := f.inode.blocks[0]
+		f.inode.blocks = f.inode.blocks[1:]
+		if rest > size {
+			rest = size
+		}
+		if z&blockMask == 0 {
+			f.buf = make([]byte, rest)
+			return nil
+		}
+		data, err := r.readBlock(f.pos, z)
+		if err != nil {
+			return err
+		}
+		f.pos += int64(z & blockMask)
+		if uint64(len(data)) > rest {
+			data = data[:rest]
+		}
+		f.buf = data
+		return nil
+	}
+	if f.inode.frag == noFragment {
+		return io.ErrUnexpectedEOF
+	}
+	data, err := r.readFragment(f.inode.frag)
+	if err != nil {
+		return err
+	}
+	offset := uint64(f.inode.offset)
+	if offset+rest > uint64(len(data)) {
+		return fmt.Errorf("squashfs: fragment %d too short", f.inode.frag)
+	}
+	f.buf = data[offset : offset+rest]
+	return nil
+}
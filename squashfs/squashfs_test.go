@@ -0,0 +1,183 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midbel/tape"
+)
+
+// The images of testdata are written by testdata/mkimage.py.
+
+func TestReader(t *testing.T) {
+	var (
+		mtime = time.Unix(1700000000, 0).UTC()
+		big   bytes.Buffer
+	)
+	for i := 0; big.Len() < 4096; i++ {
+		fmt.Fprintf(&big, "line %05d of the big file\n", i)
+	}
+	big.Truncate(4096)
+	big.Write(make([]byte, 4096))
+	big.WriteString(strings.Repeat("R", 4096))
+	big.WriteString("tail of the big file\n")
+
+	want := []struct {
+		Name    string
+		Mode    int64
+		Uid     int64
+		Gid     int64
+		Link    string
+		Content string
+	}{
+		{Name: "big.bin", Mode: tape.ModeRegular | 0644, Uid: 1000, Gid: 100, Content: big.String()},
+		{Name: "empty", Mode: tape.ModeRegular | 0600},
+		{Name: "etc", Mode: tape.ModeDir | 0755},
+		{Name: "etc/hosts", Mode: tape.ModeRegular | 0644, Content: "127.0.0.1 localhost\n"},
+		{Name: "etc/sub", Mode: tape.ModeDir | 0750, Uid: 1000, Gid: 100},
+		{Name: "etc/sub/deep.txt", Mode: tape.ModeRegular | 0640, Uid: 1000, Gid: 100, Content: strings.Repeat("deep\n", 10)},
+		{Name: "link", Mode: tape.ModeSymlink | 0777, Link: "etc/hosts"},
+		{Name: "raw.bin", Mode: tape.ModeRegular | 0644, Content: strings.Repeat("R", 4096) + "tail of the raw file\n"},
+	}
+	for _, file := range []string{"gzip.sqfs", "xz.sqfs"} {
+		var (
+			r   = openImage(t, file)
+			got int
+		)
+		for ; ; got++ {
+			h, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %s", file, err)
+			}
+			if got >= len(want) {
+				t.Fatalf("%s: unexpected entry %s", file, h.Filename)
+			}
+			w := want[got]
+			if h.Filename != w.Name {
+				t.Errorf("%s: want entry %s, got %s", file, w.Name, h.Filename)
+				continue
+			}
+			if h.Mode != w.Mode {
+				t.Errorf("%s: %s: want mode %o, got %o", file, w.Name, w.Mode, h.Mode)
+			}
+			if h.Uid != w.Uid || h.Gid != w.Gid {
+				t.Errorf("%s: %s: want owner %d:%d, got %d:%d", file, w.Name, w.Uid, w.Gid, h.Uid, h.Gid)
+			}
+			if h.Linkname != w.Link {
+				t.Errorf("%s: %s: want link %s, got %s", file, w.Name, w.Link, h.Linkname)
+			}
+			if !h.ModTime.Equal(mtime) {
+				t.Errorf("%s: %s: want mtime %s, got %s", file, w.Name, mtime, h.ModTime)
+			}
+			if !h.IsRegular() {
+				continue
+			}
+			if h.Size != int64(len(w.Content)) {
+				t.Errorf("%s: %s: want size %d, got %d", file, w.Name, len(w.Content), h.Size)
+			}
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s: %s: %s", file, w.Name, err)
+			}
+			if string(content) != w.Content {
+				t.Errorf("%s: %s: content mismatch", file, w.Name)
+			}
+		}
+		if got != len(want) {
+			t.Errorf("%s: want %d entries, got %d", file, len(want), got)
+		}
+	}
+}
+
+func TestSkipContent(t *testing.T) {
+	r := openImage(t, "gzip.sqfs")
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Filename != "raw.bin" {
+			continue
+		}
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil || string(b) != "RRRR" {
+			t.Errorf("raw.bin: unexpected content %q (%v)", b, err)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	f, err := os.Open("testdata/xzbcj.sqfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := NewReader(f); !errors.Is(err, tape.ErrUnsupported) {
+		t.Errorf("xz filters: want %v, got %v", tape.ErrUnsupported, err)
+	}
+
+	image, err := os.ReadFile("testdata/gzip.sqfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []uint16{compLzma, compLzo, compLz4, compZstd} {
+		b := append([]byte(nil), image...)
+		le.PutUint16(b[20:], c)
+		if _, err := NewReader(bytes.NewReader(b)); !errors.Is(err, tape.ErrUnsupported) {
+			t.Errorf("compression %d: want %v, got %v", c, tape.ErrUnsupported, err)
+		}
+	}
+	for _, size := range []uint32{0, 1000, 2 << 20} {
+		b := append([]byte(nil), image...)
+		le.PutUint32(b[12:], size)
+		if _, err := NewReader(bytes.NewReader(b)); err == nil {
+			t.Errorf("block size %d: invalid image accepted", size)
+		}
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	var buf bytes.Buffer
+	z := zlib.NewWriter(&buf)
+	z.Write(make([]byte, metaSize+1))
+	z.Close()
+
+	r := Reader{
+		super: superblock{
+			Compression: compGzip,
+			BlockSize:   minBlockSize,
+		},
+	}
+	if _, err := r.decompress(buf.Bytes(), metaSize); err == nil {
+		t.Errorf("metadata block larger than %d bytes accepted", metaSize)
+	}
+	if _, err := r.decompress(buf.Bytes(), metaSize+1); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func openImage(t *testing.T, file string) tape.Reader {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s: %s", file, err)
+	}
+	return r
+}
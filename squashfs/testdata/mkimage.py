@@ -0,0 +1,157 @@
+#!/usr/bin/env python3
+# mkimage.py writes the SquashFS 4.0 images used by the tests of the squashfs
+# package when squashfs-tools is not available.
+#
+#   python3 mkimage.py gzip gzip.sqfs
+#   python3 mkimage.py xz xz.sqfs
+#   python3 mkimage.py xz-bcj xzbcj.sqfs
+#
+# The images hold the same tree with a block size of 4KiB: files made of
+# compressed, sparse and uncompressed blocks ending in a fragment, small files
+# stored in the fragment block, an empty file, a symlink and directories. The
+# xz-bcj image only records the x86 filter in the options of the compressor:
+# its blocks are not filtered.
+import lzma
+import struct
+import sys
+import zlib
+
+BLOCK = 4096
+META = 8192
+MTIME = 1700000000
+
+comp = sys.argv[1]
+ids = [0, 1000, 100]
+
+
+def compress(data):
+    if comp == "gzip":
+        return zlib.compress(bytes(data), 9)
+    return lzma.compress(bytes(data), format=lzma.FORMAT_XZ, check=lzma.CHECK_CRC32)
+
+
+out = bytearray(96)
+if comp == "xz-bcj":
+    # dictionary size and filters of the xz compressor, stored uncompressed.
+    out += struct.pack("<HII", 8 | 0x8000, BLOCK, 1)
+frags = bytearray()
+inodes = bytearray()
+dirs = bytearray()
+count = [0]
+
+
+def ref(pos):
+    return (pos // META) * (META + 2), pos % META
+
+
+def add_file(content, raw=False):
+    start, sizes = len(out), []
+    full = len(content) // BLOCK
+    for i in range(full):
+        blk = content[i * BLOCK:(i + 1) * BLOCK]
+        if blk == bytes(BLOCK):
+            sizes.append(0)
+        elif raw:
+            out.extend(blk)
+            sizes.append(len(blk) | 1 << 24)
+        else:
+            c = compress(blk)
+            out.extend(c)
+            sizes.append(len(c))
+    tail, frag, off = content[full * BLOCK:], 0xFFFFFFFF, 0
+    if tail:
+        frag, off = 0, len(frags)
+        frags.extend(tail)
+    return ("file", start, frag, off, len(content), sizes)
+
+
+def inode(kind, perm, uid, gid):
+    count[0] += 1
+    return struct.pack("<HHHHII", kind, perm, uid, gid, MTIME, count[0])
+
+
+def build(node, perm, uid=0, gid=0):
+    kind = node[0]
+    if kind == "dir":
+        refs = [(name,) + build(*c) for name, c in sorted(node[1].items())]
+        start, listing, i = len(dirs), bytearray(), 0
+        while i < len(refs):
+            blk = ref(refs[i][1])[0]
+            group = [r for r in refs[i:] if ref(r[1])[0] == blk][:256]
+            listing += struct.pack("<III", len(group) - 1, blk, group[0][2])
+            for name, pos, num, t in group:
+                listing += struct.pack("<HhHH", pos % META, num - group[0][2], t, len(name) - 1)
+                listing += name.encode()
+            i += len(group)
+        dirs.extend(listing)
+        blk, off = ref(start)
+        pos = len(inodes)
+        inodes.extend(inode(1, perm, uid, gid) + struct.pack("<IIHHI", blk, 2, len(listing) + 3, off, 0))
+        return pos, count[0], 1
+    pos = len(inodes)
+    if kind == "file":
+        _, start, frag, off, size, sizes = node
+        inodes.extend(inode(2, perm, uid, gid) + struct.pack("<IIII", start, frag, off, size))
+        inodes.extend(b"".join(struct.pack("<I", z) for z in sizes))
+        return pos, count[0], 2
+    target = node[1].encode()
+    inodes.extend(inode(3, perm, uid, gid) + struct.pack("<II", 1, len(target)) + target)
+    return pos, count[0], 3
+
+
+big = b"".join(b"line %05d of the big file\n" % i for i in range(160))[:BLOCK]
+big += bytes(BLOCK) + b"R" * BLOCK + b"tail of the big file\n"
+tree = ("dir", {
+    "big.bin": (add_file(big), 0o644, 1, 2),
+    "empty": (add_file(b""), 0o600),
+    "etc": (("dir", {
+        "hosts": (add_file(b"127.0.0.1 localhost\n"), 0o644),
+        "sub": (("dir", {
+            "deep.txt": (add_file(b"deep\n" * 10), 0o640, 1, 2),
+        }), 0o750, 1, 2),
+    }), 0o755),
+    "link": (("link", "etc/hosts"), 0o777),
+    "raw.bin": (add_file(b"R" * BLOCK + b"tail of the raw file\n", raw=True), 0o644),
+})
+
+frag_start = len(out)
+frag_data = compress(frags)
+out.extend(frag_data)
+root, _, _ = build(tree, 0o755)
+
+
+def meta(data, raw=False):
+    res = bytearray()
+    for i in range(0, len(data), META):
+        chunk = bytes(data[i:i + META])
+        if raw:
+            res += struct.pack("<H", len(chunk) | 0x8000) + chunk
+        else:
+            c = compress(chunk)
+            res += struct.pack("<H", len(c)) + c
+    return res
+
+
+inode_table = len(out)
+out.extend(meta(inodes))
+dir_table = len(out)
+out.extend(meta(dirs))
+pos = len(out)
+out.extend(meta(struct.pack("<QII", frag_start, len(frag_data), 0)))
+frag_table = len(out)
+out.extend(struct.pack("<Q", pos))
+pos = len(out)
+out.extend(meta(b"".join(struct.pack("<I", i) for i in ids), raw=True))
+id_table = len(out)
+out.extend(struct.pack("<Q", pos))
+
+blk, off = ref(root)
+out[:96] = struct.pack(
+    "<IIIIIHHHHHHQQQQQQQQ",
+    0x73717368, count[0], MTIME, BLOCK, 1,
+    1 if comp == "gzip" else 4, 12, 0x0400 if comp == "xz-bcj" else 0,
+    len(ids), 4, 0, blk << 16 | off, len(out), id_table,
+    0xFFFFFFFFFFFFFFFF, inode_table, dir_table, frag_table, 0xFFFFFFFFFFFFFFFF,
+)
+out.extend(bytes(-len(out) % 4096))
+open(sys.argv[2], "wb").write(out)
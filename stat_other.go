@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package tape
+
+import (
+	"io/fs"
+)
+
+func fillStat(h *Header, fi fs.FileInfo) {}
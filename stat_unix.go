@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package tape
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func fillStat(h *Header, fi fs.FileInfo) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	dev := uint64(st.Dev)
+	h.Uid = int64(st.Uid)
+	h.Gid = int64(st.Gid)
+	h.Uname = userName(h.Uid)
+	h.Gname = groupName(h.Gid)
+	h.Inode = int64(st.Ino)
+	h.Links = int64(st.Nlink)
+	h.Major = int64(unix.Major(dev))
+	h.Minor = int64(unix.Minor(dev))
+	if h.IsDevice() {
+		rdev := uint64(st.Rdev)
+		h.RMajor = int64(unix.Major(rdev))
+		h.RMinor = int64(unix.Minor(rdev))
+	}
+}
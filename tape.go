@@ -3,6 +3,7 @@ package tape
 import (
 	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"os/user"
 	"strconv"
@@ -19,6 +20,18 @@ var (
 	ErrClosed      = errors.New("tape: archive closed")
 )
 
+const (
+	ModeType    = 0170000
+	ModeSocket  = 0140000
+	ModeSymlink = 0120000
+	ModeRegular = 0100000
+	ModeBlock   = 0060000
+	ModeDir     = 0040000
+	ModeChar    = 0020000
+	ModeFifo    = 0010000
+	ModePerm    = 0007777
+)
+
 type Reader interface {
 	io.Reader
 	Next() (*Header, error)
@@ -62,6 +75,16 @@ type Header struct {
 	Check    int64
 	ModTime  time.Time
 	Filename string
+	// Linkname is the target of a symbolic link. When set on a regular file,
+	// the entry is a hard link to the named file.
+	Linkname string
+	// Uname and Gname are the names of the owner and of the group of the
+	// entry when the format records them.
+	Uname string
+	Gname string
+	// Records are additional key/value pairs attached to the entry. They are
+	// stored as PAX records in tar archives and ignored by the other formats.
+	Records map[string]string
 }
 
 func FileInfoHeaderFromFile(file *os.File) (*Header, error) {
@@ -80,6 +103,26 @@ func FileInfoHeaderFromFile(file *os.File) (*Header, error) {
 	return &h, nil
 }
 
+// FileInfoHeaderFromInfo creates a Header from the information given by fi.
+// When fi is describing an entry of an archive, its Header is returned as is.
+func FileInfoHeaderFromInfo(fi fs.FileInfo) *Header {
+	if h, ok := fi.Sys().(*Header); ok {
+		x := *h
+		return &x
+	}
+	h := Header{
+		Filename: fi.Name(),
+		Mode:     FileMode(fi.Mode()),
+		ModTime:  fi.ModTime(),
+		Links:    1,
+	}
+	if h.IsRegular() {
+		h.Size = fi.Size()
+	}
+	fillStat(&h, fi)
+	return &h
+}
+
 func FileInfoHeader(file string) (*Header, error) {
 	r, err := os.Open(file)
 	if err != nil {
@@ -89,7 +132,95 @@ func FileInfoHeader(file string) (*Header, error) {
 	return FileInfoHeaderFromFile(r)
 }
 
+func (h Header) Perm() int64 {
+	return h.Mode & ModePerm
+}
+
+func (h Header) IsDir() bool {
+	return h.Mode&ModeType == ModeDir
+}
+
+func (h Header) IsSymlink() bool {
+	return h.Mode&ModeType == ModeSymlink
+}
+
+func (h Header) IsDevice() bool {
+	t := h.Mode & ModeType
+	return t == ModeChar || t == ModeBlock
+}
+
+func (h Header) IsRegular() bool {
+	t := h.Mode & ModeType
+	return t == 0 || t == ModeRegular
+}
+
+// FileMode converts the mode of the header to a fs.FileMode.
+func (h Header) FileMode() fs.FileMode {
+	var (
+		perm = h.Mode & ModePerm
+		mode = fs.FileMode(perm & 0777)
+	)
+	switch h.Mode & ModeType {
+	case ModeDir:
+		mode |= fs.ModeDir
+	case ModeSymlink:
+		mode |= fs.ModeSymlink
+	case ModeChar:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case ModeBlock:
+		mode |= fs.ModeDevice
+	case ModeFifo:
+		mode |= fs.ModeNamedPipe
+	case ModeSocket:
+		mode |= fs.ModeSocket
+	}
+	if perm&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if perm&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if perm&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// FileMode converts a fs.FileMode to the mode used by Header.
+func FileMode(mode fs.FileMode) int64 {
+	perm := int64(mode.Perm())
+	switch {
+	case mode.IsDir():
+		perm |= ModeDir
+	case mode&fs.ModeSymlink != 0:
+		perm |= ModeSymlink
+	case mode&fs.ModeCharDevice != 0:
+		perm |= ModeChar
+	case mode&fs.ModeDevice != 0:
+		perm |= ModeBlock
+	case mode&fs.ModeNamedPipe != 0:
+		perm |= ModeFifo
+	case mode&fs.ModeSocket != 0:
+		perm |= ModeSocket
+	default:
+		perm |= ModeRegular
+	}
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
+
 func (h Header) User() string {
+	if h.Uname != "" {
+		return h.Uname
+	}
 	var (
 		id     = strconv.FormatInt(h.Uid, 10)
 		u, err = user.LookupId(id)
@@ -101,6 +232,9 @@ func (h Header) User() string {
 }
 
 func (h Header) Group() string {
+	if h.Gname != "" {
+		return h.Gname
+	}
 	var (
 		id     = strconv.FormatInt(h.Gid, 10)
 		g, err = user.LookupGroupId(id)
@@ -21,6 +21,7 @@ const (
 	TypeChar              = '3'
 	TypeBlock             = '4'
 	TypeDir               = '5'
+	TypeFifo              = '6'
 	TypeSingleEx          = 'x'
 	TypeGlobalEx          = 'g'
 )
@@ -18,17 +18,31 @@ type Reader struct {
 	inner io.Reader
 	curr  io.Reader
 	err   error
+	count *counter
 
 	read int
 	size int
+
+	header int64
+	data   int64
 }
 
 func NewReader(r io.Reader) *Reader {
+	c := counter{
+		Reader: r,
+	}
 	return &Reader{
-		inner: r,
+		inner: &c,
+		count: &c,
 	}
 }
 
+// Offset returns the positions of the header and of the data of the current
+// entry in the underlying stream.
+func (r *Reader) Offset() (int64, int64) {
+	return r.header, r.data
+}
+
 func (r *Reader) Read(b []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
@@ -53,10 +67,15 @@ func (r *Reader) Next() (*Header, error) {
 		return nil, r.err
 	}
 	if r.curr != nil {
-		io.Copy(io.Discard, r.curr)
+		n, _ := io.Copy(io.Discard, r.curr)
+		r.read += int(n)
+		r.discard()
+		r.curr = nil
 	}
+	r.header = r.count.N
 	hdr, err := r.next()
 	if err == nil {
+		r.data = r.count.N
 		r.read = 0
 		r.size = int(hdr.Size)
 		r.curr = io.LimitReader(r.inner, hdr.Size)
@@ -130,6 +149,8 @@ func (r *Reader) readHeader() (*Header, error) {
 	if str, off = readString(block, off, lenUstar); str != ustar {
 		return &hdr, nil
 	}
+	gnu := block[off-1] == ' '
+
 	str, off = readString(block, off, lenUstarVersion)
 	if hdr.Type.isExtended() && str != ustarver {
 		return nil, fmt.Errorf("%s: unsupported %s version", str, ustar)
@@ -138,7 +159,7 @@ func (r *Reader) readHeader() (*Header, error) {
 	hdr.Group, off = readString(block, off, lenGroup)
 	hdr.DevMinor, off = readOctal(block, off, lenDevMinor)
 	hdr.DevMajor, off = readOctal(block, off, lenDevMajor)
-	if str, _ = readString(block, off, lenPrefix); str != "" {
+	if str, _ = readString(block, off, lenPrefix); str != "" && !gnu {
 		hdr.Name = filepath.Join(str, hdr.Name)
 	}
 	if err := r.updateHeader(&hdr); err != nil {
@@ -164,20 +185,20 @@ func (r *Reader) updateHeader(hdr *Header) error {
 			if value == "0" {
 				break
 			}
-			when, err := strconv.ParseInt(value, 10, 64)
+			when, err := parsePaxTime(value)
 			if err != nil {
 				return err
 			}
-			hdr.AccessTime = time.Unix(when, 0)
+			hdr.AccessTime = when
 		case paxMtime:
 			if value == "0" {
 				break
 			}
-			when, err := strconv.ParseInt(value, 10, 64)
+			when, err := parsePaxTime(value)
 			if err != nil {
 				return err
 			}
-			hdr.ModTime = time.Unix(when, 0)
+			hdr.ModTime = when
 		case paxPath:
 			hdr.Name = value
 		case paxLink:
@@ -206,8 +227,32 @@ func (r *Reader) updateHeader(hdr *Header) error {
 			hdr.Gid = int(gid)
 		}
 	}
-	discard(r.inner, blockSize-hdr.Size)
-	return scan.Err()
+	if err := scan.Err(); err != nil {
+		return err
+	}
+	if mod := hdr.Size % blockSize; mod > 0 {
+		discard(r.inner, blockSize-mod)
+	}
+	return nil
+}
+
+func parsePaxTime(str string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(str, ".")
+	when, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(when, nsec), nil
 }
 
 func parsePaxRecord(str string) (string, string, error) {
@@ -239,6 +284,17 @@ func parsePaxRecord(str string) (string, string, error) {
 // 	discard(r.inner, z)
 // }
 
+type counter struct {
+	io.Reader
+	N int64
+}
+
+func (c *counter) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	c.N += int64(n)
+	return n, err
+}
+
 func discard(r io.Reader, n int64) {
 	io.CopyN(io.Discard, r, n)
 }
@@ -0,0 +1,142 @@
+package tar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/midbel/tape"
+)
+
+// DefaultBlockingFactor is the number of blocks in a record used by tar
+// when no blocking factor is given.
+const DefaultBlockingFactor = 20
+
+// RecordSize returns the size of the records for the blocking factor.
+func RecordSize(factor int) int {
+	if factor <= 0 {
+		factor = DefaultBlockingFactor
+	}
+	return factor * blockSize
+}
+
+// NewWriterSize returns a Writer writing to w records of factor blocks. Each
+// record is given to w in a single call to Write and the last record is padded
+// with zeros when the Writer is closed. If factor is zero or negative,
+// DefaultBlockingFactor is used.
+func NewWriterSize(w io.Writer, factor int) *Writer {
+	r := recordWriter{
+		inner: w,
+		buf:   make([]byte, 0, RecordSize(factor)),
+	}
+	ws := NewWriter(&r)
+	ws.record = &r
+	return ws
+}
+
+// NewTapeWriterSize returns a TapeWriter writing records of factor blocks.
+func NewTapeWriterSize(w io.Writer, factor int) *TapeWriter {
+	return &TapeWriter{
+		Writer: NewWriterSize(w, factor),
+	}
+}
+
+// NewReaderSize returns a Reader reading from r records of factor blocks. A
+// record shorter than expected is accepted as long as it is made of whole
+// blocks. If factor is zero or negative, DefaultBlockingFactor is used.
+func NewReaderSize(r io.Reader, factor int) *Reader {
+	rs := recordReader{
+		inner:  r,
+		record: make([]byte, RecordSize(factor)),
+	}
+	return NewReader(&rs)
+}
+
+// NewTapeReaderSize returns a TapeReader reading records of factor blocks.
+func NewTapeReaderSize(r io.Reader, factor int) *TapeReader {
+	return &TapeReader{
+		Reader: NewReaderSize(r, factor),
+	}
+}
+
+type recordWriter struct {
+	inner io.Writer
+	buf   []byte
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		z := copy(w.buf[len(w.buf):cap(w.buf)], b)
+		w.buf = w.buf[:len(w.buf)+z]
+		b = b[z:]
+		n += z
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// pad completes the current record with zeros and writes it.
+func (w *recordWriter) pad() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	z := len(w.buf)
+	w.buf = w.buf[:cap(w.buf)]
+	for i := z; i < len(w.buf); i++ {
+		w.buf[i] = 0
+	}
+	return w.flush()
+}
+
+func (w *recordWriter) flush() error {
+	_, err := w.inner.Write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+type recordReader struct {
+	inner  io.Reader
+	record []byte
+	buf    []byte
+}
+
+func (r *recordReader) Read(b []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// fill reads the next record. A read returning less than a record ends it
+// once a whole number of blocks has been read.
+func (r *recordReader) fill() error {
+	var n int
+	for n == 0 || n%blockSize != 0 {
+		z, err := r.inner.Read(r.record[n:])
+		n += z
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			if n == 0 {
+				return io.EOF
+			}
+			if n%blockSize != 0 {
+				return fmt.Errorf("%w: partial block in record (%d bytes)", tape.ErrTooShort, n)
+			}
+			break
+		}
+		return err
+	}
+	r.buf = r.record[:n]
+	return nil
+}
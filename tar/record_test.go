@@ -0,0 +1,142 @@
+package tar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/midbel/tape"
+)
+
+type testEntry struct {
+	Name    string
+	Content string
+}
+
+var recordEntries = []testEntry{
+	{Name: "a.txt", Content: "hello world\n"},
+	{Name: "empty"},
+	{Name: "big.bin", Content: strings.Repeat("0123456789abcdef", 200)},
+	{Name: "block", Content: strings.Repeat("x", blockSize)},
+}
+
+// recordSizes records the size of each call to Write.
+type recordSizes struct {
+	bytes.Buffer
+	sizes []int
+}
+
+func (r *recordSizes) Write(b []byte) (int, error) {
+	r.sizes = append(r.sizes, len(b))
+	return r.Buffer.Write(b)
+}
+
+func TestRecordWriter(t *testing.T) {
+	for _, factor := range []int{1, 4, DefaultBlockingFactor} {
+		var (
+			out recordSizes
+			w   = NewTapeWriterSize(&out, factor)
+		)
+		writeEntries(t, w, recordEntries)
+		size := RecordSize(factor)
+		for i, z := range out.sizes {
+			if z != size {
+				t.Errorf("factor %d: record %d: want %d bytes, got %d", factor, i, size, z)
+			}
+		}
+		if out.Len() == 0 || out.Len()%size != 0 {
+			t.Errorf("factor %d: archive of %d bytes not padded to a record", factor, out.Len())
+		}
+		b := out.Bytes()
+		if i := bytes.LastIndexByte(b, 'x'); !bytes.Equal(b[i+1:], make([]byte, len(b)-i-1)) {
+			t.Errorf("factor %d: padding of the last record not made of zeros", factor)
+		}
+		readEntries(t, NewTapeReaderSize(bytes.NewReader(b), factor), recordEntries)
+		readEntries(t, NewTapeReader(bytes.NewReader(b)), recordEntries)
+	}
+}
+
+func TestRecordReaderShortReads(t *testing.T) {
+	var buf bytes.Buffer
+	writeEntries(t, NewTapeWriterSize(&buf, 4), recordEntries)
+
+	data := []struct {
+		Name   string
+		Reader io.Reader
+	}{
+		{Name: "one byte", Reader: iotest.OneByteReader(bytes.NewReader(buf.Bytes()))},
+		{Name: "half", Reader: iotest.HalfReader(bytes.NewReader(buf.Bytes()))},
+		{Name: "data and eof", Reader: iotest.DataErrReader(bytes.NewReader(buf.Bytes()))},
+		{Name: "short record", Reader: bytes.NewReader(buf.Bytes()[:buf.Len()-RecordSize(4)+3*blockSize])},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			readEntries(t, NewTapeReaderSize(d.Reader, 4), recordEntries)
+		})
+	}
+}
+
+func TestRecordReaderPartialBlock(t *testing.T) {
+	var buf bytes.Buffer
+	writeEntries(t, NewTapeWriterSize(&buf, 4), recordEntries[:1])
+
+	r := recordReader{
+		inner:  bytes.NewReader(buf.Bytes()[:blockSize+100]),
+		record: make([]byte, RecordSize(4)),
+	}
+	_, err := io.ReadAll(&r)
+	if !errors.Is(err, tape.ErrTooShort) {
+		t.Errorf("want %v, got %v", tape.ErrTooShort, err)
+	}
+}
+
+func writeEntries(t *testing.T, w tape.Writer, entries []testEntry) {
+	t.Helper()
+	for _, e := range entries {
+		h := tape.Header{
+			Filename: e.Name,
+			Mode:     tape.ModeRegular | 0644,
+			Size:     int64(len(e.Content)),
+			ModTime:  time.Unix(1700000000, 0),
+		}
+		if err := w.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if e.Content == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, e.Content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readEntries(t *testing.T, r tape.Reader, entries []testEntry) {
+	t.Helper()
+	for _, e := range entries {
+		h, err := r.Next()
+		if err != nil {
+			t.Fatalf("%s: %s", e.Name, err)
+		}
+		if h.Filename != e.Name {
+			t.Errorf("want entry %s, got %s", e.Name, h.Filename)
+		}
+		content := make([]byte, h.Size)
+		if _, err := io.ReadFull(r, content); err != nil {
+			t.Fatalf("%s: %s", e.Name, err)
+		}
+		if string(content) != e.Content {
+			t.Errorf("%s: content mismatch", e.Name)
+		}
+	}
+	if h, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("want end of archive, got %v (%v)", h, err)
+	}
+}
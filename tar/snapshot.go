@@ -0,0 +1,279 @@
+package tar
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeDumpDir is the type of the GNU headers of the directories written in an
+// incremental archive. Their content is the dumpdir of the directory.
+const TypeDumpDir = 'D'
+
+// DumpdirRecord is the key of the record holding the dumpdir of a directory
+// in the Records of a tape.Header.
+const DumpdirRecord = "GNU.dumpdir"
+
+const (
+	DumpIncluded  = 'Y'
+	DumpUnchanged = 'N'
+	DumpDirectory = 'D'
+)
+
+// DumpEntry is an entry of the dumpdir of a directory. The dumpdir lists all
+// the entries of a directory at the time of the backup and tells which of
+// them are included in the archive.
+type DumpEntry struct {
+	Type byte
+	Name string
+}
+
+// ParseDumpdir parses the content of a dumpdir.
+func ParseDumpdir(b []byte) ([]DumpEntry, error) {
+	var es []DumpEntry
+	for len(b) > 0 {
+		x := bytes.IndexByte(b, 0)
+		if x < 0 {
+			return nil, fmt.Errorf("%w: unterminated dumpdir entry", ErrHeader)
+		}
+		if x == 0 {
+			break
+		}
+		e := DumpEntry{
+			Type: b[0],
+			Name: string(b[1:x]),
+		}
+		switch e.Type {
+		case DumpIncluded, DumpUnchanged, DumpDirectory:
+			es = append(es, e)
+		default:
+			// GNU tar also writes rename and temporary entries that are not
+			// needed to restore the content of a directory.
+		}
+		b = b[x+1:]
+	}
+	return es, nil
+}
+
+// FormatDumpdir returns the content of the dumpdir made of es.
+func FormatDumpdir(es []DumpEntry) []byte {
+	var buf bytes.Buffer
+	for _, e := range es {
+		buf.WriteByte(e.Type)
+		buf.WriteString(e.Name)
+		buf.WriteByte(0)
+	}
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+const snapshotVersion = 2
+
+// Snapshot is the content of a GNU listed-incremental snapshot file (version
+// 2). It records the time of a backup and the state of the directories it
+// contains so the next backup only has to include what has changed since.
+type Snapshot struct {
+	Time time.Time
+	Dirs []*SnapshotDir
+
+	// header is the first line of the snapshot file read, written back
+	// as is by WriteTo.
+	header string
+}
+
+// SnapshotDir is the state of a directory recorded in a Snapshot.
+type SnapshotDir struct {
+	NFS      bool
+	ModTime  time.Time
+	Dev      uint64
+	Inode    uint64
+	Name     string
+	Contents []DumpEntry
+}
+
+// Dir returns the state of the directory name or nil if it has not been
+// recorded.
+func (s *Snapshot) Dir(name string) *SnapshotDir {
+	if s == nil {
+		return nil
+	}
+	for _, d := range s.Dirs {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Has reports whether name is listed in the contents of the directory.
+func (d *SnapshotDir) Has(name string) bool {
+	for _, e := range d.Contents {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadSnapshot reads a snapshot file in the format written by GNU tar with
+// --listed-incremental.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	rs := bufio.NewReader(r)
+	line, err := rs.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	x := strings.LastIndexByte(line, '-')
+	if !strings.HasPrefix(line, "GNU tar-") || x < 0 {
+		return nil, fmt.Errorf("snapshot: %w: %q", ErrHeader, strings.TrimSpace(line))
+	}
+	if v, _ := strconv.Atoi(strings.TrimSpace(line[x+1:])); v != snapshotVersion {
+		return nil, fmt.Errorf("snapshot: unsupported version %s", strings.TrimSpace(line[x+1:]))
+	}
+	s := Snapshot{
+		header: line,
+	}
+	if s.Time, err = readSnapshotTime(rs); err != nil {
+		return nil, err
+	}
+	for {
+		nfs, err := readSnapshotField(rs)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		d, err := readSnapshotDir(rs)
+		if err != nil {
+			return nil, err
+		}
+		d.NFS = nfs == "1"
+		s.Dirs = append(s.Dirs, d)
+	}
+	return &s, nil
+}
+
+func readSnapshotDir(rs *bufio.Reader) (*SnapshotDir, error) {
+	var (
+		d   SnapshotDir
+		err error
+	)
+	if d.ModTime, err = readSnapshotTime(rs); err != nil {
+		return nil, err
+	}
+	if d.Dev, err = readSnapshotNumber(rs); err != nil {
+		return nil, err
+	}
+	if d.Inode, err = readSnapshotNumber(rs); err != nil {
+		return nil, err
+	}
+	if d.Name, err = readSnapshotField(rs); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var dumpdir bytes.Buffer
+	for {
+		str, err := readSnapshotField(rs)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if str == "" {
+			break
+		}
+		dumpdir.WriteString(str)
+		dumpdir.WriteByte(0)
+	}
+	dumpdir.WriteByte(0)
+	if c, err := rs.ReadByte(); err != nil || c != 0 {
+		return nil, fmt.Errorf("snapshot: %s: missing record terminator", d.Name)
+	}
+	if d.Contents, err = ParseDumpdir(dumpdir.Bytes()); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func readSnapshotTime(rs *bufio.Reader) (time.Time, error) {
+	sec, err := readSnapshotNumber(rs)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec, err := readSnapshotNumber(rs)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(sec), int64(nsec)), nil
+}
+
+func readSnapshotNumber(rs *bufio.Reader) (uint64, error) {
+	str, err := readSnapshotField(rs)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	n, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("snapshot: invalid number %q", str)
+	}
+	return n, nil
+}
+
+func readSnapshotField(rs *bufio.Reader) (string, error) {
+	str, err := rs.ReadString(0)
+	if err != nil {
+		if errors.Is(err, io.EOF) && str != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return str[:len(str)-1], nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("snapshot: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// WriteTo writes the snapshot in the format read by ReadSnapshot. The
+// directories are written in the order of Dirs, so a snapshot read by
+// ReadSnapshot is written back unchanged.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if s.header != "" {
+		buf.WriteString(s.header)
+	} else {
+		fmt.Fprintf(&buf, "GNU tar-1.35-%d\n", snapshotVersion)
+	}
+	writeSnapshotTime(&buf, s.Time)
+
+	for _, d := range s.Dirs {
+		nfs := "0"
+		if d.NFS {
+			nfs = "1"
+		}
+		writeSnapshotField(&buf, nfs)
+		writeSnapshotTime(&buf, d.ModTime)
+		writeSnapshotField(&buf, strconv.FormatUint(d.Dev, 10))
+		writeSnapshotField(&buf, strconv.FormatUint(d.Inode, 10))
+		writeSnapshotField(&buf, d.Name)
+		buf.Write(FormatDumpdir(d.Contents))
+		buf.WriteByte(0)
+	}
+	return buf.WriteTo(w)
+}
+
+func writeSnapshotTime(buf *bytes.Buffer, t time.Time) {
+	writeSnapshotField(buf, strconv.FormatInt(t.Unix(), 10))
+	writeSnapshotField(buf, strconv.Itoa(t.Nanosecond()))
+}
+
+func writeSnapshotField(buf *bytes.Buffer, str string) {
+	buf.WriteString(str)
+	buf.WriteByte(0)
+}
@@ -0,0 +1,178 @@
+package tar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The files of testdata are written by GNU tar 1.34: gnu.snar is the
+// snapshot of the second backup of a directory, written to incremental.tar,
+// after a file has been added to data/sub.
+//
+//   tar --listed-incremental=gnu.snar -cf full.tar data
+//   echo n > data/sub/new
+//   tar --listed-incremental=gnu.snar -cf incremental.tar data
+
+var gnuDirs = []struct {
+	Name     string
+	Contents []DumpEntry
+}{
+	{Name: "data/sub/deep", Contents: []DumpEntry{{Type: DumpUnchanged, Name: "c"}}},
+	{Name: "data/empty"},
+	{Name: "data/sub", Contents: []DumpEntry{
+		{Type: DumpUnchanged, Name: "b"},
+		{Type: DumpDirectory, Name: "deep"},
+		{Type: DumpIncluded, Name: "new"},
+	}},
+	{Name: "data", Contents: []DumpEntry{
+		{Type: DumpUnchanged, Name: "a"},
+		{Type: DumpDirectory, Name: "empty"},
+		{Type: DumpUnchanged, Name: "link"},
+		{Type: DumpDirectory, Name: "sub"},
+	}},
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	want, err := os.ReadFile("testdata/gnu.snar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSnapshot(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if when := time.Unix(1792368227, 515356088); !s.Time.Equal(when) {
+		t.Errorf("want time %s, got %s", when, s.Time)
+	}
+	if len(s.Dirs) != len(gnuDirs) {
+		t.Fatalf("want %d directories, got %d", len(gnuDirs), len(s.Dirs))
+	}
+	for i, d := range gnuDirs {
+		got := s.Dirs[i]
+		if got.Name != d.Name {
+			t.Errorf("want directory %s, got %s", d.Name, got.Name)
+			continue
+		}
+		if !reflect.DeepEqual(got.Contents, d.Contents) {
+			t.Errorf("%s: want contents %v, got %v", d.Name, d.Contents, got.Contents)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("snapshot not written back unchanged:\nwant %q\ngot  %q", want, buf.Bytes())
+	}
+}
+
+func TestSnapshotWrite(t *testing.T) {
+	s := Snapshot{
+		Time: time.Unix(1700000000, 250),
+		Dirs: []*SnapshotDir{
+			{
+				NFS:      true,
+				ModTime:  time.Unix(1600000000, 0),
+				Dev:      64769,
+				Inode:    1234,
+				Name:     "home/user",
+				Contents: []DumpEntry{{Type: DumpIncluded, Name: "file"}},
+			},
+			{
+				ModTime: time.Unix(1600000001, 1),
+				Dev:     64769,
+				Inode:   12,
+				Name:    "home",
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "GNU tar-1.35-2\n1700000000\x00250\x00" +
+		"1\x001600000000\x000\x0064769\x001234\x00home/user\x00Yfile\x00\x00\x00" +
+		"0\x001600000001\x001\x0064769\x0012\x00home\x00\x00\x00"
+	if buf.String() != want {
+		t.Fatalf("want %q, got %q", want, buf.String())
+	}
+	got, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.header = ""
+	if !reflect.DeepEqual(got, &s) {
+		t.Errorf("want %+v, got %+v", s, got)
+	}
+}
+
+func TestIncrementalArchive(t *testing.T) {
+	f, err := os.Open("testdata/incremental.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var (
+		r    = NewTapeReader(f)
+		seen int
+	)
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !h.IsDir() {
+			continue
+		}
+		dump, ok := h.Records[DumpdirRecord]
+		if !ok {
+			t.Errorf("%s: dumpdir not found", h.Filename)
+			continue
+		}
+		got, err := ParseDumpdir([]byte(dump))
+		if err != nil {
+			t.Fatalf("%s: %s", h.Filename, err)
+		}
+		for _, d := range gnuDirs {
+			if d.Name != h.Filename {
+				continue
+			}
+			seen++
+			if !reflect.DeepEqual(got, d.Contents) {
+				t.Errorf("%s: want dumpdir %v, got %v", d.Name, d.Contents, got)
+			}
+		}
+	}
+	if seen != len(gnuDirs) {
+		t.Errorf("want %d directories, got %d", len(gnuDirs), seen)
+	}
+}
+
+func TestDumpdirTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	err := w.WriteHeader(&Header{
+		Type:    TypeDumpDir,
+		Name:    "dir/",
+		Perm:    0755,
+		Size:    maxDumpdir + 1,
+		ModTime: time.Unix(1700000000, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewTapeReader(&buf).Next()
+	if !errors.Is(err, ErrHeader) {
+		t.Errorf("want %v, got %v", ErrHeader, err)
+	}
+}
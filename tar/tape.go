@@ -0,0 +1,253 @@
+package tar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/midbel/tape"
+)
+
+// maxDumpdir bounds the size of the dumpdirs read in memory.
+const maxDumpdir = 8 << 20
+
+// TapeReader adapts a Reader to the tape.Reader interface.
+type TapeReader struct {
+	*Reader
+}
+
+func NewTapeReader(r io.Reader) *TapeReader {
+	return &TapeReader{
+		Reader: NewReader(r),
+	}
+}
+
+// Next returns the header of the next entry. The dumpdir of the directories
+// of GNU incremental archives is stored in the Records of the header under
+// DumpdirRecord.
+func (r *TapeReader) Next() (*tape.Header, error) {
+	h, err := r.Reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	t := toTapeHeader(h)
+	if h.Type == TypeDumpDir && h.Size > 0 {
+		if h.Size > maxDumpdir {
+			return nil, fmt.Errorf("%w: dumpdir of %s too large", ErrHeader, h.Name)
+		}
+		b := make([]byte, h.Size)
+		if _, err := io.ReadFull(r.Reader, b); err != nil {
+			return nil, err
+		}
+		if t.Records == nil {
+			t.Records = make(map[string]string)
+		}
+		t.Records[DumpdirRecord] = string(b)
+	}
+	return t, nil
+}
+
+// TapeWriter adapts a Writer to the tape.Writer interface.
+type TapeWriter struct {
+	*Writer
+
+	hdr  *Header
+	link bytes.Buffer
+}
+
+func NewTapeWriter(w io.Writer) *TapeWriter {
+	return &TapeWriter{
+		Writer: NewWriter(w),
+	}
+}
+
+func (w *TapeWriter) WriteHeader(h *tape.Header) error {
+	if err := w.flushLink(); err != nil {
+		return err
+	}
+	hdr := fromTapeHeader(h)
+	if hdr.Type == TypeSymLink && hdr.LinkName == "" && h.Size > 0 {
+		w.hdr = hdr
+		w.link.Reset()
+		return nil
+	}
+	if err := w.Writer.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Type == TypeDumpDir {
+		_, err := io.WriteString(w.Writer, h.Records[DumpdirRecord])
+		return err
+	}
+	return nil
+}
+
+// Write writes the content of the current entry. The content of non regular
+// files is discarded except for symbolic links which target has not been
+// given in the header.
+func (w *TapeWriter) Write(b []byte) (int, error) {
+	if w.hdr != nil {
+		return w.link.Write(b)
+	}
+	if w.curr == nil && w.err == nil {
+		return len(b), nil
+	}
+	return w.Writer.Write(b)
+}
+
+// Flush writes the pending symbolic link and the padding of the current entry.
+func (w *TapeWriter) Flush() error {
+	if err := w.flushLink(); err != nil {
+		return err
+	}
+	return w.Writer.Flush()
+}
+
+func (w *TapeWriter) Close() error {
+	if err := w.flushLink(); err != nil {
+		return err
+	}
+	return w.Writer.Close()
+}
+
+func (w *TapeWriter) flushLink() error {
+	if w.hdr == nil {
+		return nil
+	}
+	h := w.hdr
+	w.hdr = nil
+	h.LinkName = w.link.String()
+	if len(h.LinkName) > lenLink {
+		h.PaxHeaders[paxLink] = h.LinkName
+	}
+	return w.Writer.WriteHeader(h)
+}
+
+func toTapeHeader(h *Header) *tape.Header {
+	t := tape.Header{
+		Filename: strings.TrimSuffix(h.Name, "/"),
+		Mode:     h.Perm & tape.ModePerm,
+		Uid:      int64(h.Uid),
+		Gid:      int64(h.Gid),
+		Uname:    h.User,
+		Gname:    h.Group,
+		Size:     h.Size,
+		ModTime:  h.ModTime,
+		Linkname: h.LinkName,
+		Links:    1,
+	}
+	switch h.Type {
+	case TypeDir, TypeDumpDir:
+		t.Mode |= tape.ModeDir
+		t.Links = 2
+	case TypeSymLink:
+		t.Mode |= tape.ModeSymlink
+	case TypeChar:
+		t.Mode |= tape.ModeChar
+	case TypeBlock:
+		t.Mode |= tape.ModeBlock
+	case TypeFifo:
+		t.Mode |= tape.ModeFifo
+	default:
+		t.Mode |= tape.ModeRegular
+	}
+	if h.Type == TypeChar || h.Type == TypeBlock {
+		t.RMajor = h.DevMajor
+		t.RMinor = h.DevMinor
+	}
+	for k, v := range h.PaxHeaders {
+		if isPaxStandard(k) {
+			continue
+		}
+		if t.Records == nil {
+			t.Records = make(map[string]string)
+		}
+		t.Records[k] = v
+	}
+	if h.Type != TypeReg && h.Type != TypeHardLink && h.Type != 0 {
+		t.Size = 0
+	}
+	return &t
+}
+
+func fromTapeHeader(h *tape.Header) *Header {
+	t := Header{
+		Name:       h.Filename,
+		Perm:       h.Perm(),
+		Uid:        int(h.Uid),
+		Gid:        int(h.Gid),
+		User:       h.Uname,
+		Group:      h.Gname,
+		ModTime:    h.ModTime,
+		LinkName:   h.Linkname,
+		PaxHeaders: make(map[string]string),
+	}
+	switch h.Mode & tape.ModeType {
+	case tape.ModeDir:
+		t.Type = TypeDir
+		if !strings.HasSuffix(t.Name, "/") {
+			t.Name += "/"
+		}
+		if d, ok := h.Records[DumpdirRecord]; ok {
+			t.Type = TypeDumpDir
+			t.Size = int64(len(d))
+		}
+	case tape.ModeSymlink:
+		t.Type = TypeSymLink
+	case tape.ModeChar:
+		t.Type = TypeChar
+	case tape.ModeBlock:
+		t.Type = TypeBlock
+	case tape.ModeFifo:
+		t.Type = TypeFifo
+	default:
+		t.Type = TypeReg
+		t.Size = h.Size
+		if h.Linkname != "" {
+			t.Type = TypeHardLink
+			t.Size = 0
+		}
+	}
+	if t.Type == TypeChar || t.Type == TypeBlock {
+		t.DevMajor = h.RMajor
+		t.DevMinor = h.RMinor
+	}
+	for k, v := range h.Records {
+		if k == DumpdirRecord && t.Type == TypeDumpDir {
+			continue
+		}
+		t.PaxHeaders[k] = v
+	}
+	if len(t.Name) > lenName {
+		t.PaxHeaders[paxPath] = t.Name
+	}
+	if len(t.LinkName) > lenLink {
+		t.PaxHeaders[paxLink] = t.LinkName
+	}
+	if len(t.User) > lenUser {
+		t.PaxHeaders[paxUser] = t.User
+	}
+	if len(t.Group) > lenGroup {
+		t.PaxHeaders[paxGroup] = t.Group
+	}
+	return &t
+}
+
+func isPaxStandard(key string) bool {
+	switch key {
+	case paxAtime, paxMtime, paxPath, paxLink, paxUser, paxGroup, paxSize, paxUid, paxGid, paxCharset, "ctime", "comment", "hdrcharset":
+		return true
+	default:
+		return false
+	}
+}
+
+// Open returns a tape.Reader for the tar archive read from r.
+func Open(r io.Reader) (tape.Reader, error) {
+	return NewTapeReader(r), nil
+}
+
+// Create returns a tape.Writer writing a tar archive to w.
+func Create(w io.Writer) (tape.Writer, error) {
+	return NewTapeWriter(w), nil
+}
@@ -0,0 +1,340 @@
+package tar
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// TypeMultiVolume is the type of the GNU headers describing the part of a
+// file continued on a new volume.
+const TypeMultiVolume = 'M'
+
+// TypeVolumeLabel is the type of the GNU headers holding the label of a
+// volume.
+const TypeVolumeLabel = 'V'
+
+const (
+	offMagic     = 257
+	offGnuOffset = 369
+	lenGnuOffset = 12
+	oldgnu       = "ustar  \x00"
+)
+
+// VolumeName returns the name of the volume n of the archive file.
+func VolumeName(file string, n int) string {
+	return fmt.Sprintf("%s.%03d", file, n)
+}
+
+// VolumeWriter splits the tar archive written to it across volumes of a fixed
+// size. When the content of an entry does not fit in a volume, the next
+// volume starts with a GNU multi-volume header giving the name of the entry,
+// the size of its remaining content and the offset where it is continued.
+//
+// VolumeWriter is given the bytes of the archive, usually by a Writer or a
+// TapeWriter, and follows its structure to know which entry is written when
+// a volume is full.
+type VolumeWriter struct {
+	create func(int) (io.WriteCloser, error)
+	curr   io.WriteCloser
+	err    error
+
+	limit int64
+	used  int64
+	index int
+
+	header  []byte
+	payload []byte
+	path    string
+	name    string
+	size    int64
+	data    int64
+	remain  int64
+	pax     bool
+}
+
+// NewVolumeWriter returns a VolumeWriter creating its volumes with create.
+// size is the size of the volumes and should be a multiple of the size of the
+// blocks of a tar archive.
+func NewVolumeWriter(create func(int) (io.WriteCloser, error), size int64) (*VolumeWriter, error) {
+	if size < 2*blockSize || size%blockSize != 0 {
+		return nil, fmt.Errorf("tar: invalid volume size %d: multiple of %d expected", size, blockSize)
+	}
+	w := VolumeWriter{
+		create: create,
+		limit:  size,
+		header: make([]byte, 0, blockSize),
+		index:  -1,
+	}
+	return &w, nil
+}
+
+// CreateVolumes returns a VolumeWriter writing the volumes of the archive file
+// into the files named by VolumeName.
+func CreateVolumes(file string, size int64) (*VolumeWriter, error) {
+	create := func(n int) (io.WriteCloser, error) {
+		return os.Create(VolumeName(file, n))
+	}
+	return NewVolumeWriter(create, size)
+}
+
+func (w *VolumeWriter) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		if w.err != nil {
+			return n, w.err
+		}
+		if w.curr == nil || w.used >= w.limit {
+			w.err = w.next()
+			continue
+		}
+		z := len(b)
+		if left := w.limit - w.used; int64(z) > left {
+			z = int(left)
+		}
+		if w.remain == 0 {
+			if free := blockSize - len(w.header); z > free {
+				z = free
+			}
+		} else if int64(z) > w.remain {
+			z = int(w.remain)
+		}
+		if _, w.err = w.curr.Write(b[:z]); w.err != nil {
+			return n, w.err
+		}
+		w.follow(b[:z])
+		w.used += int64(z)
+		b = b[z:]
+		n += z
+	}
+	return n, nil
+}
+
+// Close closes the last volume.
+func (w *VolumeWriter) Close() error {
+	if w.curr == nil {
+		return w.err
+	}
+	err := w.curr.Close()
+	w.curr = nil
+	if w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// follow updates the state of the archive with the bytes written.
+func (w *VolumeWriter) follow(b []byte) {
+	if w.remain > 0 {
+		if w.pax {
+			w.payload = append(w.payload, b...)
+		}
+		if left := w.size - w.data; left > 0 {
+			if int64(len(b)) < left {
+				left = int64(len(b))
+			}
+			w.data += left
+		}
+		w.remain -= int64(len(b))
+		if w.remain == 0 && w.pax {
+			w.path = paxPathRecord(w.payload[:w.size])
+		}
+		return
+	}
+	w.header = append(w.header, b...)
+	if len(w.header) < blockSize {
+		return
+	}
+	defer func() {
+		w.header = w.header[:0]
+	}()
+	if bytes.Equal(w.header, zeros) {
+		return
+	}
+	var (
+		typ     = TypeFlag(w.header[156])
+		size, _ = readOctal(w.header, 124, lenSize)
+	)
+	switch typ {
+	case TypeHardLink, TypeSymLink, TypeChar, TypeBlock, TypeDir, TypeFifo:
+		size = 0
+	}
+	w.size, w.data = size, 0
+	w.remain = size
+	if mod := size % blockSize; mod > 0 {
+		w.remain += blockSize - mod
+	}
+	w.pax = typ == TypeSingleEx
+	w.payload = w.payload[:0]
+	// the records of an extended header split across volumes are continued
+	// under the name of the extended header: the name of the entry it
+	// describes is only known once all its records have been written.
+	if w.path != "" && !w.pax {
+		w.name, w.path = w.path, ""
+	} else {
+		w.name, _ = readString(w.header, 0, lenName)
+		if string(w.header[offMagic:offMagic+lenUstar]) == ustar+"\x00" {
+			if prefix, _ := readString(w.header, 345, lenPrefix); prefix != "" {
+				w.name = prefix + "/" + w.name
+			}
+		}
+	}
+}
+
+func (w *VolumeWriter) next() error {
+	if w.curr != nil {
+		if err := w.curr.Close(); err != nil {
+			return err
+		}
+	}
+	w.index++
+	c, err := w.create(w.index)
+	if err != nil {
+		return err
+	}
+	w.curr, w.used = c, 0
+	if left := w.size - w.data; w.remain > 0 && left > 0 {
+		return w.writeContinuation(left)
+	}
+	return nil
+}
+
+func (w *VolumeWriter) writeContinuation(left int64) error {
+	var (
+		buf  = make([]byte, blockSize)
+		name = w.name
+	)
+	if len(name) > lenName {
+		name = name[:lenName]
+	}
+	writeString(buf, name, 0, lenName)
+	writeOctal(buf, 0, 100, lenMode)
+	writeOctal(buf, 0, 108, lenUid)
+	writeOctal(buf, 0, 116, lenGid)
+	writeOctal(buf, left, 124, lenSize)
+	writeOctal(buf, 0, 136, lenTime)
+	writeString(buf, emptySum, 148, lenSum)
+	writeType(buf, TypeMultiVolume, 156, lenType)
+	writeString(buf, oldgnu, offMagic, len(oldgnu))
+	writeOctal(buf, w.data, offGnuOffset, lenGnuOffset)
+	writeChecksum(buf, 148)
+
+	n, err := w.curr.Write(buf)
+	w.used += int64(n)
+	return err
+}
+
+func paxPathRecord(b []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		name, value, err := parsePaxRecord(s.Text())
+		if err == nil && name == paxPath {
+			return value
+		}
+	}
+	return ""
+}
+
+// VolumeReader reads the volumes of a multi-volume archive as a single
+// stream. The volume labels and the multi-volume headers found at the
+// beginning of the volumes are skipped.
+type VolumeReader struct {
+	open  func(int) (io.ReadCloser, error)
+	curr  io.ReadCloser
+	err   error
+	index int
+
+	pending []byte
+}
+
+// NewVolumeReader returns a VolumeReader opening its volumes with open. The
+// archive ends with the last volume for which open returns an error
+// satisfying errors.Is(err, fs.ErrNotExist).
+func NewVolumeReader(open func(int) (io.ReadCloser, error)) *VolumeReader {
+	return &VolumeReader{
+		open:  open,
+		index: -1,
+	}
+}
+
+// OpenVolumes returns a VolumeReader reading the volumes of the archive file
+// named by VolumeName.
+func OpenVolumes(file string) *VolumeReader {
+	open := func(n int) (io.ReadCloser, error) {
+		return os.Open(VolumeName(file, n))
+	}
+	return NewVolumeReader(open)
+}
+
+func (r *VolumeReader) Read(b []byte) (int, error) {
+	for {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if len(r.pending) > 0 {
+			n := copy(b, r.pending)
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+		if r.curr == nil {
+			r.err = r.next()
+			continue
+		}
+		n, err := r.curr.Read(b)
+		if errors.Is(err, io.EOF) {
+			r.curr.Close()
+			r.curr = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *VolumeReader) Close() error {
+	if r.curr == nil {
+		return nil
+	}
+	err := r.curr.Close()
+	r.curr = nil
+	return err
+}
+
+func (r *VolumeReader) next() error {
+	r.index++
+	c, err := r.open(r.index)
+	if err != nil {
+		if r.index > 0 && errors.Is(err, os.ErrNotExist) {
+			return io.EOF
+		}
+		return err
+	}
+	r.curr = c
+	if r.index == 0 {
+		return nil
+	}
+	for {
+		buf := make([]byte, blockSize)
+		n, err := io.ReadFull(c, buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			r.pending = buf[:n]
+			return nil
+		}
+		switch buf[156] {
+		case TypeVolumeLabel:
+			continue
+		case TypeMultiVolume:
+			return nil
+		default:
+			r.pending = buf
+			return nil
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package tar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testVolumeSize = 4 * blockSize
+
+// memVolumes stores the volumes of an archive in memory.
+type memVolumes struct {
+	volumes []*bytes.Buffer
+}
+
+func (m *memVolumes) create(n int) (io.WriteCloser, error) {
+	if n != len(m.volumes) {
+		return nil, fmt.Errorf("volume %d created after volume %d", n, len(m.volumes)-1)
+	}
+	var buf bytes.Buffer
+	m.volumes = append(m.volumes, &buf)
+	return nopCloser{&buf}, nil
+}
+
+func (m *memVolumes) open(n int) (io.ReadCloser, error) {
+	if n >= len(m.volumes) {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(m.volumes[n].Bytes())), nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestVolumeSpanningEntry(t *testing.T) {
+	var (
+		content = makeContent(3 * testVolumeSize)
+		entries = []testEntry{
+			{Name: "small", Content: "small file\n"},
+			{Name: "spanning", Content: content},
+			{Name: "after", Content: "after the spanning file\n"},
+		}
+		m = writeVolumes(t, entries)
+	)
+	for i, v := range m.volumes {
+		if v.Len() > testVolumeSize {
+			t.Errorf("volume %d: want at most %d bytes, got %d", i, testVolumeSize, v.Len())
+		}
+	}
+	if len(m.volumes) < 4 {
+		t.Fatalf("want at least 4 volumes, got %d", len(m.volumes))
+	}
+	// the content of spanning starts in the third block of the first volume
+	// after the header of small, its content and its own header.
+	var (
+		offset = int64(testVolumeSize - 3*blockSize)
+		left   = int64(len(content)) - offset
+	)
+	for i, v := range m.volumes[1:4] {
+		b := v.Bytes()[:blockSize]
+		if typ := TypeFlag(b[156]); typ != TypeMultiVolume {
+			t.Errorf("volume %d: want type %c, got %c", i+1, TypeMultiVolume, typ)
+			continue
+		}
+		if name, _ := readString(b, 0, lenName); name != "spanning" {
+			t.Errorf("volume %d: want name spanning, got %s", i+1, name)
+		}
+		if size, _ := readOctal(b, 124, lenSize); size != left {
+			t.Errorf("volume %d: want %d bytes left, got %d", i+1, left, size)
+		}
+		if off, _ := readOctal(b, offGnuOffset, lenGnuOffset); off != offset {
+			t.Errorf("volume %d: want offset %d, got %d", i+1, offset, off)
+		}
+		offset += testVolumeSize - blockSize
+		left -= testVolumeSize - blockSize
+	}
+	readEntries(t, NewTapeReader(NewVolumeReader(m.open)), entries)
+}
+
+// TestVolumeBoundaries moves the header of an entry with a long name across
+// the end of the first volume so that the volume ends in turn after its
+// extended header, in the middle of the records of the extended header, and
+// after its own header.
+func TestVolumeBoundaries(t *testing.T) {
+	long := strings.Repeat("very-long-directory-name/", 28) + "file.txt"
+	for blocks := 0; blocks < 6; blocks++ {
+		entries := []testEntry{
+			{Name: "first", Content: makeContent(blocks * blockSize)},
+			{Name: long, Content: makeContent(2*blockSize + 10)},
+			{Name: "last", Content: "last\n"},
+		}
+		t.Run(fmt.Sprintf("%d blocks", blocks), func(t *testing.T) {
+			m := writeVolumes(t, entries)
+			if len(m.volumes) < 2 {
+				t.Fatalf("want at least 2 volumes, got %d", len(m.volumes))
+			}
+			readEntries(t, NewTapeReader(NewVolumeReader(m.open)), entries)
+		})
+	}
+}
+
+func TestVolumeSize(t *testing.T) {
+	var m memVolumes
+	for _, size := range []int64{0, blockSize, 3*blockSize + 1} {
+		if _, err := NewVolumeWriter(m.create, size); err == nil {
+			t.Errorf("volume size %d accepted", size)
+		}
+	}
+}
+
+func writeVolumes(t *testing.T, entries []testEntry) *memVolumes {
+	t.Helper()
+	var m memVolumes
+	vw, err := NewVolumeWriter(m.create, testVolumeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, NewTapeWriter(vw), entries)
+	if err := vw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
+
+// makeContent returns size bytes that differ from one block to the next.
+func makeContent(size int) string {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "%08d|", i)
+	}
+	return buf.String()[:size]
+}
@@ -2,8 +2,10 @@ package tar
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -18,6 +20,8 @@ type Writer struct {
 	curr  io.Writer
 	err   error
 
+	record *recordWriter
+
 	size    int
 	written int
 }
@@ -56,7 +60,7 @@ func (w *Writer) WriteHeader(h *Header) error {
 	w.err = w.writeHeader(h)
 	if w.err == nil {
 		w.reset()
-		if h.Type == TypeReg {
+		if h.Type == TypeReg || h.Type == TypeDumpDir {
 			w.curr = tape.LimitWriter(w.inner, h.Size)
 		}
 		w.size = int(h.Size)
@@ -90,9 +94,12 @@ func (w *Writer) Close() error {
 	for i := 0; i < 2; i++ {
 		_, w.err = w.inner.Write(zeros)
 		if w.err != nil {
-			break
+			return w.err
 		}
 	}
+	if w.record != nil {
+		w.err = w.record.pad()
+	}
 	return w.err
 }
 
@@ -246,3 +253,40 @@ func writeBytes(buf, str []byte, offset, size int) int {
 func writeString(buf []byte, str string, offset, size int) int {
 	return writeBytes(buf, []byte(str), offset, size)
 }
+
+// OpenAppend prepares the tar archive stored in f to receive new entries. The
+// end-of-archive blocks are removed and the returned Writer starts writing
+// where they were.
+func OpenAppend(f *os.File) (*Writer, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var (
+		r   = NewReader(f)
+		end int64
+	)
+	for {
+		h, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		_, data := r.Offset()
+		end = data
+		if h.Type != TypeDir && h.Type != TypeSymLink && h.Type != TypeHardLink {
+			end += h.Size
+		}
+		if mod := end % blockSize; mod > 0 {
+			end += blockSize - mod
+		}
+	}
+	if err := f.Truncate(end); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return NewWriter(f), nil
+}
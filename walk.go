@@ -0,0 +1,172 @@
+package tape
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+type readLinkFS interface {
+	ReadLink(string) (string, error)
+}
+
+type FSOptions struct {
+	// Prefix is prepended to the names of all the entries.
+	Prefix string
+	// Paths are the roots of the walk. The whole fs.FS is written when Paths
+	// is empty.
+	Paths []string
+
+	// FileMode and DirMode, when not zero, replace the permissions of the
+	// files and of the directories.
+	FileMode int64
+	DirMode  int64
+
+	// Uid and Gid replace the owner of all the entries when Owner is set.
+	Owner bool
+	Uid   int64
+	Gid   int64
+
+	// ModTime, when not zero, replaces the modification time of all the
+	// entries.
+	ModTime time.Time
+
+	// Sorted writes the paths in lexical order whatever the order in which
+	// they have been given. Entries found below a path are always written in
+	// lexical order.
+	Sorted bool
+
+	// Digest, when set, is the name of the algorithm used to compute the
+	// digest of the content of the regular files. The digest is added to
+	// the Records of their header.
+	Digest string
+}
+
+// WriteFS walks fsys and writes all the files and directories found to w.
+func WriteFS(w Writer, fsys fs.FS, opts FSOptions) error {
+	paths := opts.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	if opts.Sorted {
+		paths = append([]string{}, paths...)
+		sort.Strings(paths)
+	}
+	for _, p := range paths {
+		err := fs.WalkDir(fsys, p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if file == "." {
+				return nil
+			}
+			return writeEntry(w, fsys, file, d, opts)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEntry(w Writer, fsys fs.FS, file string, d fs.DirEntry, opts FSOptions) error {
+	i, err := d.Info()
+	if err != nil {
+		return err
+	}
+	h := FileInfoHeaderFromInfo(i)
+	h.Filename = path.Join(opts.Prefix, file)
+	if h.IsSymlink() {
+		rl, ok := fsys.(readLinkFS)
+		if !ok {
+			return fmt.Errorf("%s: %w: symbolic link", file, ErrUnsupported)
+		}
+		if h.Linkname, err = rl.ReadLink(file); err != nil {
+			return err
+		}
+	}
+	opts.apply(h)
+	if opts.Digest != "" && h.IsRegular() {
+		return writeDigest(w, fsys, file, h, opts.Digest)
+	}
+	if err := w.WriteHeader(h); err != nil {
+		return err
+	}
+	if !h.IsRegular() || h.Size == 0 {
+		return nil
+	}
+	r, err := fsys.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.CopyN(w, r, h.Size)
+	return err
+}
+
+func (o FSOptions) apply(h *Header) {
+	switch {
+	case h.IsDir() && o.DirMode != 0:
+		h.Mode = ModeDir | (o.DirMode & ModePerm)
+	case h.IsRegular() && o.FileMode != 0:
+		h.Mode = ModeRegular | (o.FileMode & ModePerm)
+	}
+	if o.Owner {
+		h.Uid = o.Uid
+		h.Gid = o.Gid
+		h.Uname = userName(o.Uid)
+		h.Gname = groupName(o.Gid)
+	}
+	if !o.ModTime.IsZero() {
+		h.ModTime = o.ModTime
+	}
+}
+
+func writeDigest(w Writer, fsys fs.FS, file string, h *Header, algo string) error {
+	r, err := fsys.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := WriteDigest(w, h, r, algo); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// WriteDigest writes h to w followed by the h.Size bytes read from r. The
+// digest of the content is added to the records of h. The header comes before
+// the content, so the content is spooled while its digest is computed and r is
+// only read once.
+func WriteDigest(w Writer, h *Header, r io.Reader, algo string) error {
+	sum, err := NewHash(algo)
+	if err != nil {
+		return err
+	}
+	var sp spool
+	defer sp.Close()
+	n, err := io.Copy(&sp, io.TeeReader(io.LimitReader(r, h.Size), sum))
+	if err != nil {
+		return err
+	}
+	if n != h.Size {
+		return fmt.Errorf("%w: content shrank while being read", ErrTooShort)
+	}
+	if h.Records == nil {
+		h.Records = make(map[string]string)
+	}
+	h.Records[DigestPrefix+algo] = hex.EncodeToString(sum.Sum(nil))
+	if err := w.WriteHeader(h); err != nil {
+		return err
+	}
+	rs, err := sp.Reader()
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, rs, h.Size)
+	return err
+}